@@ -20,12 +20,58 @@ type (
 		environment string
 		logLevel    int
 
+		authSettings        AuthSettings
 		corsSettings        CORSSettings
 		databaseSettings    DatabaseSettings
+		mailerSettings      MailerSettings
 		rateLimiterSettings RateLimiterSettings
 		serverSettings      ServerSettings
 	}
 
+	// AuthSettings configures account and credential behaviour for the auth service.
+	AuthSettings struct {
+		accessTokenFormat  string
+		defaultPermissions []string
+		jwtAudience        string
+		jwtIssuer          string
+		jwtKeyFiles        []string
+		jwtTTL             time.Duration
+		oidcIssuer         string
+
+		accountDeletionGracePeriod time.Duration
+
+		auditBatchSize     int
+		auditFlushInterval time.Duration
+		auditQueueSize     int
+
+		loginBackoffBase      time.Duration
+		loginLockoutDuration  time.Duration
+		loginLockoutNotify    bool
+		loginMaxAttempts      int
+		loginMaxAttemptsPerIP int
+
+		passwordArgon2Iterations  int
+		passwordArgon2Memory      int
+		passwordArgon2Parallelism int
+		passwordBcryptCost        int
+		passwordBreachedCorpus    string
+		passwordHashAlgorithm     string
+		passwordMaxLength         int
+		passwordMinLength         int
+		passwordRejectCommon      bool
+
+		identityProviders []IdentityProviderSettings
+	}
+
+	// IdentityProviderSettings configures an upstream OpenID Connect provider users can log in through.
+	IdentityProviderSettings struct {
+		clientID     string
+		clientSecret string
+		issuer       string
+		name         string
+		scopes       []string
+	}
+
 	// CORSSettings defines the settings for Cross-Origin Resource Sharing.
 	CORSSettings struct {
 		corsEnabled    bool
@@ -41,6 +87,17 @@ type (
 		maxIdleConns       int
 	}
 
+	// MailerSettings holds configuration for delivering email, either through an SMTP server or to a local directory.
+	MailerSettings struct {
+		driver       string
+		fileDir      string
+		sender       string
+		smtpHost     string
+		smtpPassword string
+		smtpPort     int
+		smtpUsername string
+	}
+
 	// RateLimiterSettings configures the rate limiting behavior.
 	RateLimiterSettings struct {
 		burst   int
@@ -68,6 +125,33 @@ type (
 		HTTPSCertificateKeyFilePath() string
 		LogLevel() int
 
+		AccessTokenFormat() string
+		AccountDeletionGracePeriod() time.Duration
+		AuditBatchSize() int
+		AuditFlushInterval() time.Duration
+		AuditQueueSize() int
+		DefaultPermissions() []string
+		IdentityProviders() []IdentityProviderSettings
+		JWTAudience() string
+		JWTIssuer() string
+		JWTKeyFiles() []string
+		JWTTTL() time.Duration
+		LoginBackoffBase() time.Duration
+		LoginLockoutDuration() time.Duration
+		LoginLockoutNotify() bool
+		LoginMaxAttempts() int
+		LoginMaxAttemptsPerIP() int
+		OIDCIssuer() string
+		PasswordArgon2Iterations() int
+		PasswordArgon2Memory() int
+		PasswordArgon2Parallelism() int
+		PasswordBcryptCost() int
+		PasswordBreachedCorpus() string
+		PasswordHashAlgorithm() string
+		PasswordMaxLength() int
+		PasswordMinLength() int
+		PasswordRejectCommon() bool
+
 		CORSEnabled() bool
 		CORSTrustedOrigins() []string
 
@@ -84,6 +168,14 @@ type (
 		IdleTimeout() time.Duration
 		ReadTimeout() time.Duration
 		WriteTimeout() time.Duration
+
+		MailerDriver() string
+		MailerFileDir() string
+		SMTPHost() string
+		SMTPPort() int
+		SMTPUsername() string
+		SMTPPassword() string
+		SMTPSender() string
 	}
 )
 
@@ -103,6 +195,38 @@ func (cb *Builder) Build() *AppConfig {
 		// Application level settings
 		environment: cb.getenv("ENVIRONMENT", "development"),
 
+		authSettings: AuthSettings{
+			accessTokenFormat:  cb.getenv("AUTH_ACCESS_TOKEN_FORMAT", "opaque"),
+			defaultPermissions: cb.getenvList("AUTH_DEFAULT_PERMISSIONS", []string{}),
+			jwtAudience:        cb.getenv("JWT_AUDIENCE", "services"),
+			jwtIssuer:          cb.getenv("JWT_ISSUER", "auth-v1"),
+			jwtKeyFiles:        cb.getenvList("JWT_KEY_FILES", []string{}),
+			jwtTTL:             time.Duration(cb.getenvInt("JWT_TTL", 900)) * time.Second,
+			oidcIssuer:         cb.getenv("OIDC_ISSUER", "http://localhost:8080/api/v1/auth"),
+			identityProviders:  cb.identityProviders(),
+
+			accountDeletionGracePeriod: time.Duration(cb.getenvInt("ACCOUNT_DELETION_GRACE_PERIOD", 2592000)) * time.Second,
+
+			auditBatchSize:     cb.getenvInt("AUDIT_BATCH_SIZE", 100),
+			auditFlushInterval: time.Duration(cb.getenvInt("AUDIT_FLUSH_INTERVAL", 1)) * time.Second,
+			auditQueueSize:     cb.getenvInt("AUDIT_QUEUE_SIZE", 4096),
+
+			loginBackoffBase:      time.Duration(cb.getenvInt("LOGIN_BACKOFF_BASE", 1)) * time.Second,
+			loginLockoutDuration:  time.Duration(cb.getenvInt("LOGIN_LOCKOUT_DURATION", 900)) * time.Second,
+			loginLockoutNotify:    cb.getenvBool("LOGIN_LOCKOUT_NOTIFY", true),
+			loginMaxAttempts:      cb.getenvInt("LOGIN_MAX_ATTEMPTS", 5),
+			loginMaxAttemptsPerIP: cb.getenvInt("LOGIN_MAX_ATTEMPTS_PER_IP", 50),
+
+			passwordArgon2Iterations:  cb.getenvInt("PASSWORD_ARGON2_ITERATIONS", 3),
+			passwordArgon2Memory:      cb.getenvInt("PASSWORD_ARGON2_MEMORY", 64*1024),
+			passwordArgon2Parallelism: cb.getenvInt("PASSWORD_ARGON2_PARALLELISM", 2),
+			passwordBcryptCost:        cb.getenvInt("PASSWORD_BCRYPT_COST", 12),
+			passwordBreachedCorpus:    cb.getenv("PASSWORD_BREACHED_CORPUS", ""),
+			passwordHashAlgorithm:     cb.getenv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+			passwordMaxLength:         cb.getenvInt("PASSWORD_MAX_LENGTH", 72),
+			passwordMinLength:         cb.getenvInt("PASSWORD_MIN_LENGTH", 8),
+			passwordRejectCommon:      cb.getenvBool("PASSWORD_REJECT_COMMON", true),
+		},
 		corsSettings: CORSSettings{
 			corsEnabled:    cb.getenvBool("CORS_ENABLED", false),
 			trustedOrigins: cb.getenvList("CORS_ALLOWED_ORIGINS", []string{"*"}),
@@ -114,6 +238,15 @@ func (cb *Builder) Build() *AppConfig {
 			maxIdleConns:       cb.getenvInt("DB_MAX_IDLE_CONNS", 2),
 			maxOpenConns:       cb.getenvInt("DB_MAX_OPEN_CONNS", 5),
 		},
+		mailerSettings: MailerSettings{
+			driver:       cb.getenv("MAILER_DRIVER", "smtp"),
+			fileDir:      cb.getenv("MAILER_FILE_DIR", ".mail"),
+			sender:       cb.getenv("SMTP_SENDER", "Auth Service <no-reply@localhost>"),
+			smtpHost:     cb.getenv("SMTP_HOST", "localhost"),
+			smtpPassword: cb.getenv("SMTP_PASSWORD", ""),
+			smtpPort:     cb.getenvInt("SMTP_PORT", 25),
+			smtpUsername: cb.getenv("SMTP_USERNAME", ""),
+		},
 		rateLimiterSettings: RateLimiterSettings{
 			burst:   cb.getenvInt("RATE_LIMIT_BURST", 3),
 			enabled: cb.getenvBool("RATE_LIMIT_ENABLED", false),
@@ -133,6 +266,24 @@ func (cb *Builder) Build() *AppConfig {
 	return cfg
 }
 
+// AccessTokenFormat returns the format of access tokens issued on login, either "opaque" or "jwt".
+func (c *AppConfig) AccessTokenFormat() string { return c.authSettings.accessTokenFormat }
+
+// AccountDeletionGracePeriod returns how long a deleted account is kept, and can be restored, before it is purged.
+// Zero purges accounts as soon as they are deleted.
+func (c *AppConfig) AccountDeletionGracePeriod() time.Duration {
+	return c.authSettings.accountDeletionGracePeriod
+}
+
+// AuditBatchSize returns the most audit events written to the database in one transaction.
+func (c *AppConfig) AuditBatchSize() int { return c.authSettings.auditBatchSize }
+
+// AuditFlushInterval returns the longest an audit event waits to be written while its batch fills up.
+func (c *AppConfig) AuditFlushInterval() time.Duration { return c.authSettings.auditFlushInterval }
+
+// AuditQueueSize returns how many audit events may be waiting to be written before further events are dropped.
+func (c *AppConfig) AuditQueueSize() int { return c.authSettings.auditQueueSize }
+
 // Burst returns the burst limit for the rate limiter.
 func (c *AppConfig) Burst() int { return c.rateLimiterSettings.burst }
 
@@ -151,6 +302,9 @@ func (c *AppConfig) ConnMaxLifetime() time.Duration { return c.databaseSettings.
 // DbConnectionString returns the connection string for the database.
 func (c *AppConfig) DbConnectionString() string { return c.databaseSettings.dbConnectionString }
 
+// DefaultPermissions returns the permission codes granted to newly registered users.
+func (c *AppConfig) DefaultPermissions() []string { return c.authSettings.defaultPermissions }
+
 // Environment returns the current application environment (e.g., development, production).
 func (c *AppConfig) Environment() string { return c.environment }
 
@@ -170,9 +324,48 @@ func (c *AppConfig) HTTPSCertificateKeyFilePath() string {
 	return c.serverSettings.httpsCertificateKeyFilePath
 }
 
+// IdentityProviders returns the upstream OpenID Connect providers users can log in through.
+func (c *AppConfig) IdentityProviders() []IdentityProviderSettings {
+	return c.authSettings.identityProviders
+}
+
+// JWTAudience returns the aud claim set on, and required of, JWT access tokens.
+func (c *AppConfig) JWTAudience() string { return c.authSettings.jwtAudience }
+
+// JWTIssuer returns the iss claim set on, and required of, JWT access tokens.
+func (c *AppConfig) JWTIssuer() string { return c.authSettings.jwtIssuer }
+
+// JWTKeyFiles returns the paths of PEM encoded private keys used for JWTs, the first being the active signing key.
+func (c *AppConfig) JWTKeyFiles() []string { return c.authSettings.jwtKeyFiles }
+
+// JWTTTL returns the lifetime of JWT access tokens.
+func (c *AppConfig) JWTTTL() time.Duration { return c.authSettings.jwtTTL }
+
 // LogLevel returns the log level for the application.
 func (c *AppConfig) LogLevel() int { return c.logLevel }
 
+// LoginBackoffBase returns the delay enforced after the first failed login, doubled for each further failure.
+func (c *AppConfig) LoginBackoffBase() time.Duration { return c.authSettings.loginBackoffBase }
+
+// LoginLockoutDuration returns how long an account or IP address stays locked once it reaches its failed login limit,
+// which is also how long failures are remembered.
+func (c *AppConfig) LoginLockoutDuration() time.Duration { return c.authSettings.loginLockoutDuration }
+
+// LoginLockoutNotify returns whether users are emailed a security notice when their account is locked.
+func (c *AppConfig) LoginLockoutNotify() bool { return c.authSettings.loginLockoutNotify }
+
+// LoginMaxAttempts returns the number of consecutive failed logins after which an account is locked.
+func (c *AppConfig) LoginMaxAttempts() int { return c.authSettings.loginMaxAttempts }
+
+// LoginMaxAttemptsPerIP returns the number of consecutive failed logins after which an IP address is locked out.
+func (c *AppConfig) LoginMaxAttemptsPerIP() int { return c.authSettings.loginMaxAttemptsPerIP }
+
+// MailerDriver returns the name of the driver used to deliver email (smtp, file or memory).
+func (c *AppConfig) MailerDriver() string { return c.mailerSettings.driver }
+
+// MailerFileDir returns the directory the file mailer driver writes email to.
+func (c *AppConfig) MailerFileDir() string { return c.mailerSettings.fileDir }
+
 // MaxIdleConns returns the maximum number of idle connections to the database.
 func (c *AppConfig) MaxIdleConns() int { return c.databaseSettings.maxIdleConns }
 
@@ -182,9 +375,56 @@ func (c *AppConfig) MaxOpenConns() int { return c.databaseSettings.maxOpenConns
 // RPS returns the rate limit for requests per second.
 func (c *AppConfig) RPS() int { return c.rateLimiterSettings.rps }
 
+// OIDCIssuer returns the externally reachable URL of the auth service, used as the OpenID Connect issuer and as the
+// base of the endpoints advertised by discovery.
+func (c *AppConfig) OIDCIssuer() string { return strings.TrimSuffix(c.authSettings.oidcIssuer, "/") }
+
+// PasswordArgon2Iterations returns the number of passes argon2id makes over its memory when hashing a password.
+func (c *AppConfig) PasswordArgon2Iterations() int { return c.authSettings.passwordArgon2Iterations }
+
+// PasswordArgon2Memory returns the amount of memory, in KiB, argon2id uses when hashing a password.
+func (c *AppConfig) PasswordArgon2Memory() int { return c.authSettings.passwordArgon2Memory }
+
+// PasswordArgon2Parallelism returns the number of lanes argon2id uses when hashing a password.
+func (c *AppConfig) PasswordArgon2Parallelism() int { return c.authSettings.passwordArgon2Parallelism }
+
+// PasswordBcryptCost returns the work factor bcrypt uses when hashing a password.
+func (c *AppConfig) PasswordBcryptCost() int { return c.authSettings.passwordBcryptCost }
+
+// PasswordBreachedCorpus returns the path of the file of breached password SHA-1 hashes new passwords are checked
+// against, or an empty string if the check is disabled.
+func (c *AppConfig) PasswordBreachedCorpus() string { return c.authSettings.passwordBreachedCorpus }
+
+// PasswordHashAlgorithm returns the algorithm new password hashes are made with (argon2id or bcrypt).
+func (c *AppConfig) PasswordHashAlgorithm() string { return c.authSettings.passwordHashAlgorithm }
+
+// PasswordMaxLength returns the maximum length of a new password in bytes.
+func (c *AppConfig) PasswordMaxLength() int { return c.authSettings.passwordMaxLength }
+
+// PasswordMinLength returns the minimum length of a new password in bytes.
+func (c *AppConfig) PasswordMinLength() int { return c.authSettings.passwordMinLength }
+
+// PasswordRejectCommon returns a boolean indicating if new passwords found in the common passwords list are rejected.
+func (c *AppConfig) PasswordRejectCommon() bool { return c.authSettings.passwordRejectCommon }
+
 // RateLimitEnabled returns a boolean indicating if rate limiting is enabled.
 func (c *AppConfig) RateLimitEnabled() bool { return c.rateLimiterSettings.enabled }
 
+// SMTPHost returns the host of the SMTP server used to deliver email.
+func (c *AppConfig) SMTPHost() string { return c.mailerSettings.smtpHost }
+
+// SMTPPort returns the port of the SMTP server used to deliver email.
+func (c *AppConfig) SMTPPort() int { return c.mailerSettings.smtpPort }
+
+// SMTPUsername returns the username used to authenticate with the SMTP server.
+func (c *AppConfig) SMTPUsername() string { return c.mailerSettings.smtpUsername }
+
+// SMTPPassword returns the password used to authenticate with the SMTP server.
+func (c *AppConfig) SMTPPassword() string { return c.mailerSettings.smtpPassword }
+
+// SMTPSender returns the address email is sent from.
+func (c *AppConfig) SMTPSender() string { return c.mailerSettings.sender }
+
 // IdleTimeout returns the idle timeout duration for the server.
 func (c *AppConfig) IdleTimeout() time.Duration { return c.serverSettings.idleTimeout }
 
@@ -194,6 +434,28 @@ func (c *AppConfig) ReadTimeout() time.Duration { return c.serverSettings.readTi
 // WriteTimeout returns the write timeout duration for the server.
 func (c *AppConfig) WriteTimeout() time.Duration { return c.serverSettings.writeTimeout }
 
+// identityProviders reads the providers named in IDENTITY_PROVIDERS, each configured by IDP_<NAME>_ISSUER,
+// IDP_<NAME>_CLIENT_ID, IDP_<NAME>_CLIENT_SECRET and optionally IDP_<NAME>_SCOPES, where <NAME> is the upper-cased
+// provider name with dashes replaced by underscores.
+func (cb *Builder) identityProviders() []IdentityProviderSettings {
+	names := cb.getenvList("IDENTITY_PROVIDERS", []string{})
+	providers := make([]IdentityProviderSettings, 0, len(names))
+
+	for _, name := range names {
+		prefix := "IDP_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+
+		providers = append(providers, IdentityProviderSettings{
+			clientID:     cb.getenv(prefix+"CLIENT_ID", ""),
+			clientSecret: cb.getenv(prefix+"CLIENT_SECRET", ""),
+			issuer:       cb.getenv(prefix+"ISSUER", ""),
+			name:         name,
+			scopes:       cb.getenvList(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+		})
+	}
+
+	return providers
+}
+
 func (cb *Builder) getenv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -229,3 +491,18 @@ func (cb *Builder) getenvList(key string, fallback []string) []string {
 	log.Printf("ENV %s is empty, using fallback", key)
 	return fallback
 }
+
+// ClientID returns the client ID registered with the provider.
+func (p IdentityProviderSettings) ClientID() string { return p.clientID }
+
+// ClientSecret returns the client secret registered with the provider.
+func (p IdentityProviderSettings) ClientSecret() string { return p.clientSecret }
+
+// Issuer returns the provider's issuer URL, from which its configuration is discovered.
+func (p IdentityProviderSettings) Issuer() string { return p.issuer }
+
+// Name returns the name identifying the provider in routes and linked identities.
+func (p IdentityProviderSettings) Name() string { return p.name }
+
+// Scopes returns the scopes requested from the provider.
+func (p IdentityProviderSettings) Scopes() []string { return p.scopes }
@@ -0,0 +1,32 @@
+package encoding
+
+import (
+	"encoding/json"
+)
+
+// Optional is a request field that tells apart a field absent from the JSON document, one explicitly set to null and
+// one set to a value, which a pointer field cannot. It is meant for partial updates, where an absent field is left
+// unchanged but null may clear it.
+type Optional[T any] struct {
+	// Set reports whether the field was present in the document, whether or not it was null.
+	Set bool
+
+	// Null reports whether the field was present and null.
+	Null bool
+
+	// Value holds the decoded value when the field was present and not null.
+	Value T
+}
+
+// UnmarshalJSON records that the field was present and decodes its value. It is only called for fields present in
+// the document, including those set to null.
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+
+	if string(data) == "null" {
+		o.Null = true
+		return nil
+	}
+
+	return json.Unmarshal(data, &o.Value)
+}
@@ -0,0 +1,227 @@
+// Package jwt implements signing and verification of compact JSON Web Tokens using RS256 and EdDSA keys. A KeySet
+// holds one active signing key alongside any number of verification-only keys, identified by a `kid` header, so that
+// keys can be rotated while tokens signed with an older key continue to verify until they expire. The public half of
+// a KeySet can be published as a JSON Web Key Set.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// AlgorithmRS256 is RSASSA-PKCS1-v1_5 using SHA-256.
+	AlgorithmRS256 = "RS256"
+
+	// AlgorithmEdDSA is EdDSA using the Ed25519 curve.
+	AlgorithmEdDSA = "EdDSA"
+)
+
+var (
+	// ErrMalformed is returned when a token is not a well-formed compact JWS.
+	ErrMalformed = errors.New("malformed token")
+
+	// ErrUnknownKey is returned when a token names a key that is not in the KeySet.
+	ErrUnknownKey = errors.New("unknown signing key")
+
+	// ErrInvalidSignature is returned when a token's signature does not verify.
+	ErrInvalidSignature = errors.New("invalid token signature")
+
+	// ErrExpired is returned when a token's exp claim is in the past.
+	ErrExpired = errors.New("token has expired")
+
+	// ErrNotYetValid is returned when a token's nbf claim is in the future.
+	ErrNotYetValid = errors.New("token is not yet valid")
+
+	// ErrInvalidIssuer is returned when a token's iss claim does not match the expected issuer.
+	ErrInvalidIssuer = errors.New("invalid token issuer")
+
+	// ErrInvalidAudience is returned when a token's aud claim does not include the expected audience.
+	ErrInvalidAudience = errors.New("invalid token audience")
+
+	// ErrNoSigningKey is returned when signing with a KeySet that holds only public keys.
+	ErrNoSigningKey = errors.New("key set has no signing key")
+)
+
+var encoding = base64.RawURLEncoding
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// Audience is the aud claim, which may be encoded as a single string or an array of strings.
+type Audience []string
+
+// MarshalJSON encodes a single audience as a string and multiple audiences as an array.
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON accepts either a string or an array of strings.
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+
+	*a = multiple
+	return nil
+}
+
+// Contains reports whether the audience includes value.
+func (a Audience) Contains(value string) bool {
+	return slices.Contains(a, value)
+}
+
+// RegisteredClaims holds the claims defined by RFC 7519. Embed it in an application-specific claims struct.
+type RegisteredClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Validate checks the time-based claims against now and, when non-empty, the issuer and audience.
+func (c *RegisteredClaims) Validate(issuer, audience string, now time.Time) error {
+	if c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt {
+		return ErrExpired
+	}
+
+	if c.NotBefore != 0 && now.Unix() < c.NotBefore {
+		return ErrNotYetValid
+	}
+
+	if issuer != "" && c.Issuer != issuer {
+		return ErrInvalidIssuer
+	}
+
+	if audience != "" && !c.Audience.Contains(audience) {
+		return ErrInvalidAudience
+	}
+
+	return nil
+}
+
+// Sign encodes claims as a JWT signed with the KeySet's signing key.
+func (ks *KeySet) Sign(claims any) (string, error) {
+	key := ks.signing
+	if key == nil {
+		return "", ErrNoSigningKey
+	}
+
+	headerJSON, err := json.Marshal(header{Algorithm: key.Algorithm, Type: "JWT", KeyID: key.ID})
+	if err != nil {
+		return "", err
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("encoding claims: %w", err)
+	}
+
+	signingInput := encoding.EncodeToString(headerJSON) + "." + encoding.EncodeToString(claimsJSON)
+
+	signature, err := key.sign([]byte(signingInput))
+	if err != nil {
+		return "", fmt.Errorf("signing token: %w", err)
+	}
+
+	return signingInput + "." + encoding.EncodeToString(signature), nil
+}
+
+// Verify checks the token's signature against the key named by its kid header and decodes its payload into claims.
+// It does not validate any claims; call RegisteredClaims.Validate on the result.
+func (ks *KeySet) Verify(token string, claims any) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrMalformed
+	}
+
+	headerJSON, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return ErrMalformed
+	}
+
+	key := ks.lookup(h.KeyID)
+	if key == nil {
+		return ErrUnknownKey
+	}
+
+	// Never let the token choose the algorithm; it must be the one the key was registered with.
+	if h.Algorithm != key.Algorithm {
+		return ErrInvalidSignature
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return ErrInvalidSignature
+	}
+
+	claimsJSON, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if err := json.Unmarshal(claimsJSON, claims); err != nil {
+		return ErrMalformed
+	}
+
+	return nil
+}
+
+func (k *Key) sign(signingInput []byte) ([]byte, error) {
+	switch k.Algorithm {
+	case AlgorithmRS256:
+		digest := sha256.Sum256(signingInput)
+		return k.private.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case AlgorithmEdDSA:
+		return k.private.Sign(rand.Reader, signingInput, crypto.Hash(0))
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", k.Algorithm)
+	}
+}
+
+func (k *Key) verify(signingInput, signature []byte) bool {
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(public, signingInput, signature)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,335 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return private
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return private
+}
+
+func newKeySet(t *testing.T, private crypto.Signer) *KeySet {
+	t.Helper()
+
+	key, err := NewKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewKeySet(key)
+}
+
+// writeKey writes the private key to a PEM file in a temporary directory and returns its path.
+func writeKey(t *testing.T, name string, block *pem.Block) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// tokenHeader decodes the header of a compact JWS.
+func tokenHeader(t *testing.T, token string) header {
+	t.Helper()
+
+	data, err := encoding.DecodeString(strings.Split(token, ".")[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var h header
+	if err := json.Unmarshal(data, &h); err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func TestSignVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		private crypto.Signer
+		want    string
+	}{
+		{name: "RS256", private: newRSAKey(t), want: AlgorithmRS256},
+		{name: "EdDSA", private: newEd25519Key(t), want: AlgorithmEdDSA},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := newKeySet(t, tt.private)
+
+			claims := RegisteredClaims{
+				Issuer:    "auth-v1",
+				Subject:   "42",
+				Audience:  Audience{"api"},
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+				IssuedAt:  time.Now().Unix(),
+			}
+
+			token, err := ks.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if h := tokenHeader(t, token); h.Algorithm != tt.want || h.KeyID != ks.signing.ID {
+				t.Errorf("got header %+v, want alg %s and kid %s", h, tt.want, ks.signing.ID)
+			}
+
+			var got RegisteredClaims
+			if err := ks.Verify(token, &got); err != nil {
+				t.Fatalf("verifying: %v", err)
+			}
+
+			if got.Subject != claims.Subject || got.ExpiresAt != claims.ExpiresAt || !got.Audience.Contains("api") {
+				t.Errorf("got claims %+v, want %+v", got, claims)
+			}
+
+			// Any change to the payload invalidates the signature.
+			parts := strings.Split(token, ".")
+			tampered := parts[0] + "." + encoding.EncodeToString([]byte(`{"sub":"1"}`)) + "." + parts[2]
+			if err := ks.Verify(tampered, &got); !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("tampered payload: got %v, want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsMismatchedAlgorithm(t *testing.T) {
+	ks := newKeySet(t, newEd25519Key(t))
+
+	token, err := ks.Sign(RegisteredClaims{Subject: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(token, ".")
+
+	for _, alg := range []string{AlgorithmRS256, "HS256", "none"} {
+		headerJSON, err := json.Marshal(header{Algorithm: alg, Type: "JWT", KeyID: ks.signing.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		forged := encoding.EncodeToString(headerJSON) + "." + parts[1] + "." + parts[2]
+
+		var claims RegisteredClaims
+		if err := ks.Verify(forged, &claims); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("alg %s: got %v, want %v", alg, err, ErrInvalidSignature)
+		}
+	}
+}
+
+func TestVerifyUnknownKey(t *testing.T) {
+	token, err := newKeySet(t, newEd25519Key(t)).Sign(RegisteredClaims{Subject: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims RegisteredClaims
+	if err := newKeySet(t, newEd25519Key(t)).Verify(token, &claims); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("got %v, want %v", err, ErrUnknownKey)
+	}
+}
+
+func TestLoadKeySetRotation(t *testing.T) {
+	oldKey := newEd25519Key(t)
+	oldDER, err := x509.MarshalPKCS8PrivateKey(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPath := writeKey(t, "old.pem", &pem.Block{Type: "PRIVATE KEY", Bytes: oldDER})
+
+	newKey := newRSAKey(t)
+	newPath := writeKey(t, "new.pem", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(newKey)})
+
+	before, err := LoadKeySet(oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldToken, err := before.Sign(RegisteredClaims{Subject: "42"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotating puts the new key first and keeps the old one for verification.
+	after, err := LoadKeySet(newPath, oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims RegisteredClaims
+	if err := after.Verify(oldToken, &claims); err != nil || claims.Subject != "42" {
+		t.Fatalf("verifying a token signed before the rotation: got %v and %+v", err, claims)
+	}
+
+	newToken, err := after.Sign(RegisteredClaims{Subject: "43"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h := tokenHeader(t, newToken); h.Algorithm != AlgorithmRS256 || h.KeyID == tokenHeader(t, oldToken).KeyID {
+		t.Errorf("got header %+v, want the new RS256 key", h)
+	}
+
+	if err := before.Verify(newToken, &claims); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("verifying with the old key set: got %v, want %v", err, ErrUnknownKey)
+	}
+
+	if _, err := LoadKeySet(writeKey(t, "bad.pem", &pem.Block{Type: "CERTIFICATE", Bytes: oldDER})); err == nil {
+		t.Error("loaded a PEM block that is not a private key")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Now()
+
+	valid := RegisteredClaims{
+		Issuer:    "auth-v1",
+		Audience:  Audience{"api", "admin"},
+		ExpiresAt: now.Add(time.Minute).Unix(),
+		NotBefore: now.Add(-time.Minute).Unix(),
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *RegisteredClaims)
+		want   error
+	}{
+		{name: "valid", modify: func(c *RegisteredClaims) {}, want: nil},
+		{
+			name:   "expired",
+			modify: func(c *RegisteredClaims) { c.ExpiresAt = now.Add(-time.Second).Unix() },
+			want:   ErrExpired,
+		},
+		{
+			name:   "not yet valid",
+			modify: func(c *RegisteredClaims) { c.NotBefore = now.Add(time.Minute).Unix() },
+			want:   ErrNotYetValid,
+		},
+		{
+			name:   "wrong issuer",
+			modify: func(c *RegisteredClaims) { c.Issuer = "someone-else" },
+			want:   ErrInvalidIssuer,
+		},
+		{
+			name:   "wrong audience",
+			modify: func(c *RegisteredClaims) { c.Audience = Audience{"other"} },
+			want:   ErrInvalidAudience,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid
+			tt.modify(&claims)
+
+			if err := claims.Validate("auth-v1", "api", now); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := NewKey(newRSAKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edKey, err := NewKey(newEd25519Key(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks := NewKeySet(rsaKey, edKey)
+
+	data, err := json.Marshal(ks.JWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(set.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(set.Keys))
+	}
+
+	if k := set.Keys[0]; k["kty"] != "RSA" || k["alg"] != AlgorithmRS256 || k["use"] != "sig" ||
+		k["kid"] != rsaKey.ID || k["e"] != "AQAB" || k["n"] == "" {
+		t.Errorf("got RSA key %v", k)
+	}
+
+	if k := set.Keys[1]; k["kty"] != "OKP" || k["crv"] != "Ed25519" || k["alg"] != AlgorithmEdDSA ||
+		k["use"] != "sig" || k["kid"] != edKey.ID || k["x"] == "" {
+		t.Errorf("got Ed25519 key %v", k)
+	}
+
+	// Nothing private is published.
+	for _, k := range set.Keys {
+		if _, ok := k["d"]; ok {
+			t.Errorf("key %s publishes its private part", k["kid"])
+		}
+	}
+
+	// A verifier holding only the published keys accepts tokens from either key, identified by the same kid.
+	published, err := ParseJWKS(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []*Key{rsaKey, edKey} {
+		token, err := NewKeySet(key).Sign(RegisteredClaims{Subject: "42"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var claims RegisteredClaims
+		if err := published.Verify(token, &claims); err != nil {
+			t.Errorf("verifying a %s token against the JWKS: %v", key.Algorithm, err)
+		}
+	}
+
+	if _, err := published.Sign(RegisteredClaims{}); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("signing with published keys: got %v, want %v", err, ErrNoSigningKey)
+	}
+}
@@ -0,0 +1,284 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"slices"
+)
+
+// Key is a signing or verification key identified by its RFC 7638 thumbprint.
+type Key struct {
+	ID        string
+	Algorithm string
+
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// KeySet is an ordered collection of keys, the first of which holding a private key is used for signing.
+type KeySet struct {
+	signing *Key
+	keys    []*Key
+}
+
+// JWK is the JSON representation of a public key as defined by RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+
+	// RSA public key members.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Octet key pair members.
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewKey wraps an RSA or Ed25519 private key for signing.
+func NewKey(private crypto.Signer) (*Key, error) {
+	key := &Key{private: private, public: private.Public()}
+
+	switch key.public.(type) {
+	case *rsa.PublicKey:
+		key.Algorithm = AlgorithmRS256
+	case ed25519.PublicKey:
+		key.Algorithm = AlgorithmEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", private)
+	}
+
+	key.ID = key.thumbprint()
+
+	return key, nil
+}
+
+// NewKeySet returns a KeySet holding keys, signing with the first key that has a private part.
+func NewKeySet(keys ...*Key) *KeySet {
+	ks := &KeySet{keys: keys}
+
+	for _, key := range keys {
+		if key.private != nil {
+			ks.signing = key
+			break
+		}
+	}
+
+	return ks
+}
+
+// GenerateKeySet returns a KeySet holding a single freshly generated Ed25519 key. Tokens it signs stop verifying once
+// the process exits, so it is only suitable for development.
+func GenerateKeySet() (*KeySet, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := NewKey(private)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeySet(key), nil
+}
+
+// LoadKeySet reads PEM encoded PKCS#8 or PKCS#1 private keys from paths. The first key becomes the signing key; the
+// rest are kept so that tokens signed before a rotation still verify.
+func LoadKeySet(paths ...string) (*KeySet, error) {
+	keys := make([]*Key, 0, len(paths))
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading signing key: %w", err)
+		}
+
+		private, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing signing key %s: %w", path, err)
+		}
+
+		key, err := NewKey(private)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	return NewKeySet(keys...), nil
+}
+
+// ParseJWKS decodes a JSON Web Key Set into a verification-only KeySet, skipping keys of unsupported types.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decoding jwks: %w", err)
+	}
+
+	keys := make([]*Key, 0, len(set.Keys))
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key := &Key{ID: jwk.KeyID}
+
+		switch jwk.KeyType {
+		case "RSA":
+			n, errN := encoding.DecodeString(jwk.N)
+			e, errE := encoding.DecodeString(jwk.E)
+			if errN != nil || errE != nil {
+				return nil, errors.New("decoding jwks: malformed RSA key")
+			}
+
+			key.Algorithm = AlgorithmRS256
+			key.public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "OKP":
+			x, err := encoding.DecodeString(jwk.X)
+			if err != nil || jwk.Curve != "Ed25519" || len(x) != ed25519.PublicKeySize {
+				continue
+			}
+
+			key.Algorithm = AlgorithmEdDSA
+			key.public = ed25519.PublicKey(x)
+		default:
+			continue
+		}
+
+		if key.ID == "" {
+			key.ID = key.thumbprint()
+		}
+
+		keys = append(keys, key)
+	}
+
+	return NewKeySet(keys...), nil
+}
+
+// JWKS returns the public keys of the set as a JSON Web Key Set.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0, len(ks.keys))}
+
+	for _, key := range ks.keys {
+		jwk := key.jwk()
+		jwk.Use = "sig"
+		jwk.Algorithm = key.Algorithm
+		jwk.KeyID = key.ID
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// Algorithms returns the distinct signing algorithms of the keys in the set.
+func (ks *KeySet) Algorithms() []string {
+	algorithms := make([]string, 0, len(ks.keys))
+
+	for _, key := range ks.keys {
+		if !slices.Contains(algorithms, key.Algorithm) {
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+
+	return algorithms
+}
+
+func (ks *KeySet) lookup(kid string) *Key {
+	// Tokens without a kid can only be matched unambiguously against a single key.
+	if kid == "" {
+		if len(ks.keys) == 1 {
+			return ks.keys[0]
+		}
+		return nil
+	}
+
+	for _, key := range ks.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func (k *Key) jwk() JWK {
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType: "RSA",
+			N:       encoding.EncodeToString(public.N.Bytes()),
+			E:       encoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       encoding.EncodeToString(public),
+		}
+	default:
+		return JWK{}
+	}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint of the public key, which is stable across restarts and makes a
+// good kid.
+func (k *Key) thumbprint() string {
+	jwk := k.jwk()
+
+	var members string
+	switch jwk.KeyType {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Curve, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return encoding.EncodeToString(sum[:])
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var _ Mailer = (*FileMailer)(nil)
+
+// FileMailer writes each message as an .eml file into a directory instead of delivering it, so that local and CI
+// runs can inspect outgoing email without an SMTP server.
+type FileMailer struct {
+	dir    string
+	sender string
+}
+
+// NewFileMailer returns a FileMailer that writes messages from sender into dir.
+func NewFileMailer(dir, sender string) *FileMailer {
+	return &FileMailer{
+		dir:    dir,
+		sender: sender,
+	}
+}
+
+// Send writes the message to a new file named after the current time and the recipient.
+func (m *FileMailer) Send(_ context.Context, msg *Message) error {
+	body, err := compose(m.sender, msg)
+	if err != nil {
+		return fmt.Errorf("composing message: %w", err)
+	}
+
+	if err := os.MkdirAll(m.dir, 0o750); err != nil {
+		return fmt.Errorf("creating mail directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), filepath.Base(msg.To))
+	if err := os.WriteFile(filepath.Join(m.dir, name), body, 0o600); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+
+	return nil
+}
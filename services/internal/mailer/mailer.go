@@ -0,0 +1,99 @@
+// Package mailer provides a pluggable abstraction for sending email from services. It defines the Mailer interface
+// along with an SMTP implementation for real delivery, a file-drop implementation that writes messages to disk, and
+// an in-memory implementation that records messages so flows which send email can be exercised without a mail
+// server. Message bodies are rendered from templates embedded in the binary.
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"text/template"
+
+	"github.com/badrchoubai/services/internal/config"
+)
+
+const (
+	// DriverSMTP delivers email through the configured SMTP server.
+	DriverSMTP = "smtp"
+
+	// DriverFile writes each email to a file in the configured directory.
+	DriverFile = "file"
+
+	// DriverMemory keeps email in memory for inspection.
+	DriverMemory = "memory"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Message is a single email addressed to one recipient, with plain-text and HTML alternatives of the same body.
+type Message struct {
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Mailer defines the interface for delivering email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New returns the Mailer selected by the configured mailer driver.
+func New(cfg *config.AppConfig) (Mailer, error) {
+	switch cfg.MailerDriver() {
+	case DriverSMTP:
+		return NewSMTPMailer(
+			cfg.SMTPHost(),
+			cfg.SMTPPort(),
+			cfg.SMTPUsername(),
+			cfg.SMTPPassword(),
+			cfg.SMTPSender(),
+		)
+	case DriverFile:
+		return NewFileMailer(cfg.MailerFileDir(), cfg.SMTPSender()), nil
+	case DriverMemory:
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer driver %q", cfg.MailerDriver())
+	}
+}
+
+// NewMessage renders the named template with data into a Message for recipient. Each template defines a "subject"
+// and "plainBody" template, executed with text/template, and an "htmlBody" template, executed with html/template.
+func NewMessage(recipient, templateFile string, data any) (*Message, error) {
+	tmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, fmt.Errorf("parsing email template: %w", err)
+	}
+
+	subject := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("rendering email subject: %w", err)
+	}
+
+	plainBody := new(bytes.Buffer)
+	if err := tmpl.ExecuteTemplate(plainBody, "plainBody", data); err != nil {
+		return nil, fmt.Errorf("rendering email plain body: %w", err)
+	}
+
+	htmlTmpl, err := htmltemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, fmt.Errorf("parsing email template: %w", err)
+	}
+
+	htmlBody := new(bytes.Buffer)
+	if err := htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data); err != nil {
+		return nil, fmt.Errorf("rendering email html body: %w", err)
+	}
+
+	return &Message{
+		To:        recipient,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
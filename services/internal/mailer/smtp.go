@@ -0,0 +1,107 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+var _ Mailer = (*SMTPMailer)(nil)
+
+// SMTPMailer delivers messages through an SMTP server, upgrading the connection with STARTTLS when the server
+// supports it and authenticating when a username is configured.
+type SMTPMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	sender   *mail.Address
+	timeout  time.Duration
+}
+
+// NewSMTPMailer returns an SMTPMailer that sends from sender through the server at host:port. The sender is an RFC
+// 5322 address such as "Auth Service <no-reply@example.com>"; an error is returned if it does not parse.
+func NewSMTPMailer(host string, port int, username, password, sender string) (*SMTPMailer, error) {
+	addr, err := mail.ParseAddress(sender)
+	if err != nil {
+		return nil, fmt.Errorf("parsing smtp sender %q: %w", sender, err)
+	}
+
+	return &SMTPMailer{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		sender:   addr,
+		timeout:  10 * time.Second,
+	}, nil
+}
+
+// Send delivers the message, giving up once ctx is done or the mailer's timeout elapses.
+func (m *SMTPMailer) Send(ctx context.Context, msg *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(m.host, strconv.Itoa(m.port)))
+	if err != nil {
+		return fmt.Errorf("dialing smtp server: %w", err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("creating smtp client: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host, MinVersion: tls.VersionTLS12}); err != nil {
+			return fmt.Errorf("starting tls: %w", err)
+		}
+	}
+
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("authenticating with smtp server: %w", err)
+		}
+	}
+
+	// The envelope takes the bare address; the display name only belongs in the From header.
+	if err := client.Mail(m.sender.Address); err != nil {
+		return fmt.Errorf("setting sender: %w", err)
+	}
+
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("setting recipient: %w", err)
+	}
+
+	body, err := compose(m.sender.String(), msg)
+	if err != nil {
+		return fmt.Errorf("composing message: %w", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("opening message body: %w", err)
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("writing message body: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("closing message body: %w", err)
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,121 @@
+package mailer
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts a single connection and speaks just enough SMTP to take delivery of one message, without
+// offering STARTTLS or authentication. It sends each command it receives on the returned channel, closing it once the
+// client quits.
+func fakeSMTPServer(t *testing.T) (string, int, <-chan string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	commands := make(chan string, 16)
+
+	go func() {
+		defer close(commands)
+
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		tp := textproto.NewConn(conn)
+		_ = tp.PrintfLine("220 localhost ESMTP")
+
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			commands <- line
+
+			verb, _, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(verb) {
+			case "EHLO", "HELO":
+				_ = tp.PrintfLine("250 localhost")
+			case "DATA":
+				_ = tp.PrintfLine("354 end data with <CR><LF>.<CR><LF>")
+				if _, err := io.Copy(io.Discard, tp.DotReader()); err != nil {
+					return
+				}
+				_ = tp.PrintfLine("250 OK")
+			case "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				return
+			default:
+				_ = tp.PrintfLine("250 OK")
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return host, portNumber, commands
+}
+
+func TestSMTPMailerEnvelopeSender(t *testing.T) {
+	host, port, commands := fakeSMTPServer(t)
+
+	m, err := NewSMTPMailer(host, port, "", "", "Auth Service <no-reply@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := &Message{
+		To:        "alice@example.com",
+		Subject:   "Welcome",
+		PlainBody: "Hello",
+		HTMLBody:  "<p>Hello</p>",
+	}
+
+	if err := m.Send(context.Background(), msg); err != nil {
+		t.Fatalf("sending: %v", err)
+	}
+
+	var mailFrom, rcptTo string
+	for command := range commands {
+		switch {
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			mailFrom = command
+		case strings.HasPrefix(command, "RCPT TO:"):
+			rcptTo = command
+		}
+	}
+
+	// Anything after the address, such as the BODY parameter, is up to the client.
+	if !strings.HasPrefix(mailFrom, "MAIL FROM:<no-reply@example.com>") {
+		t.Fatalf("got %q, want the bare sender address", mailFrom)
+	}
+
+	if rcptTo != "RCPT TO:<alice@example.com>" {
+		t.Fatalf("got %q, want the recipient address", rcptTo)
+	}
+}
+
+func TestNewSMTPMailerInvalidSender(t *testing.T) {
+	if _, err := NewSMTPMailer("localhost", 25, "", "", "Auth Service no-reply"); err == nil {
+		t.Fatal("got no error for a sender that is not an address")
+	}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+
+	"github.com/badrchoubai/services/internal/encoding"
+)
+
+// ErrInvalidToken is returned by an Authenticator when a token is malformed, unknown or expired.
+var ErrInvalidToken = errors.New("invalid or expired authentication token")
+
+type authErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Authenticator resolves a bearer token presented by a caller to the User it was issued for. Implementations backed by
+// the database live with the service that issues the credentials.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*User, error)
+}
+
+// Authenticate resolves the `Authorization: Bearer <token>` header, or an `X-API-Key` header in its place, to a User
+// and stores it in the request context. Each authenticator is tried in turn until one accepts the token. Requests
+// without either header continue as the AnonymousUser, as do requests carrying Basic credentials; malformed tokens,
+// tokens every authenticator rejects, and requests sending both headers are answered with a 401.
+func Authenticate(logger *zap.Logger, authenticators ...Authenticator) Middleware {
+	encoderDecoder := encoding.NewEncoderDecoder()
+
+	invalidToken := func(w http.ResponseWriter) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeAuthError(encoderDecoder, w, http.StatusUnauthorized, ErrInvalidToken.Error())
+	}
+
+	f := func(next http.Handler) http.Handler {
+		fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Authorization")
+			w.Header().Add("Vary", "X-API-Key")
+
+			authorizationHeader := r.Header.Get("Authorization")
+			apiKey := r.Header.Get("X-API-Key")
+
+			if apiKey != "" {
+				// A request must not be able to claim two identities at once.
+				if authorizationHeader != "" {
+					invalidToken(w)
+					return
+				}
+
+				authorizationHeader = "Bearer " + apiKey
+			}
+
+			if authorizationHeader == "" {
+				next.ServeHTTP(w, ContextSetUser(r, AnonymousUser))
+				return
+			}
+
+			headerParts := strings.Split(authorizationHeader, " ")
+
+			// Basic credentials identify OAuth2 clients rather than users and are checked by the endpoints that
+			// accept them.
+			if len(headerParts) == 2 && headerParts[0] == "Basic" {
+				next.ServeHTTP(w, ContextSetUser(r, AnonymousUser))
+				return
+			}
+
+			if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+				invalidToken(w)
+				return
+			}
+
+			user, err := authenticate(r.Context(), authenticators, headerParts[1])
+			if err != nil {
+				if errors.Is(err, ErrInvalidToken) {
+					invalidToken(w)
+					return
+				}
+
+				logger.Error("authenticating request", zap.Error(err))
+				writeAuthError(
+					encoderDecoder,
+					w,
+					http.StatusInternalServerError,
+					"the server encountered a problem and could not process your request",
+				)
+				return
+			}
+
+			r = ContextSetToken(r, headerParts[1])
+			next.ServeHTTP(w, ContextSetUser(r, user))
+		})
+		return fn
+	}
+	return f
+}
+
+func authenticate(ctx context.Context, authenticators []Authenticator, token string) (*User, error) {
+	for _, authenticator := range authenticators {
+		user, err := authenticator.Authenticate(ctx, token)
+		if errors.Is(err, ErrInvalidToken) {
+			continue
+		}
+
+		return user, err
+	}
+
+	return nil, ErrInvalidToken
+}
+
+func writeAuthError(encoderDecoder encoding.EncoderDecoder, w http.ResponseWriter, status int, message string) {
+	_ = encoderDecoder.EncodeResponse(w, status, &authErrorResponse{Error: message})
+}
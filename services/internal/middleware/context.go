@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"slices"
+)
+
+type contextKey string
+
+const (
+	tokenContextKey = contextKey("token")
+	userContextKey  = contextKey("user")
+)
+
+// AnonymousUser is stored in the request context when a caller presents no credentials.
+var AnonymousUser = &User{}
+
+// User is the authenticated caller attached to a request by the Authenticate middleware.
+type User struct {
+	ID          int64
+	Name        string
+	Email       string
+	Activated   bool
+	Permissions []string
+
+	// ClientID and Scopes are set when the caller presented an access token issued to an OAuth2 client, which acts
+	// for the user only within the granted scopes.
+	ClientID string
+	Scopes   []string
+
+	// APIKeyID is set when the caller authenticated with an API key rather than by logging in.
+	APIKeyID int64
+}
+
+// IsAnonymous reports whether the user is the AnonymousUser.
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+// HasPermission reports whether the user has been granted the given permission code.
+func (u *User) HasPermission(code string) bool {
+	return slices.Contains(u.Permissions, code)
+}
+
+// IsDelegated reports whether the user was authenticated with an access token issued to an OAuth2 client.
+func (u *User) IsDelegated() bool {
+	return u.ClientID != ""
+}
+
+// HasScope reports whether the user's OAuth2 access token was granted the given scope.
+func (u *User) HasScope(scope string) bool {
+	return slices.Contains(u.Scopes, scope)
+}
+
+// IsAPIKey reports whether the user was authenticated with an API key.
+func (u *User) IsAPIKey() bool {
+	return u.APIKeyID != 0
+}
+
+// ContextSetUser returns a shallow copy of the request with the user added to its context.
+func ContextSetUser(r *http.Request, user *User) *http.Request {
+	ctx := context.WithValue(r.Context(), userContextKey, user)
+	return r.WithContext(ctx)
+}
+
+// ContextGetUser returns the user stored in the request context, falling back to the AnonymousUser when the request
+// has not passed through Authenticate.
+func ContextGetUser(r *http.Request) *User {
+	user, ok := r.Context().Value(userContextKey).(*User)
+	if !ok {
+		return AnonymousUser
+	}
+
+	return user
+}
+
+// ContextSetToken returns a shallow copy of the request with the presented bearer token added to its context.
+func ContextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// ContextGetToken returns the bearer token the request was authenticated with, or an empty string for anonymous
+// requests.
+func ContextGetToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
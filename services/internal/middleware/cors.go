@@ -16,10 +16,11 @@ func Cors(enabled bool, trustedOrigins []string) Middleware {
 					for i := range trustedOrigins {
 						if origin == trustedOrigins[i] {
 							w.Header().Set("Access-Control-Allow-Origin", origin)
+							w.Header().Set("Access-Control-Expose-Headers", "ETag, Retry-After")
 
 							if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 								w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-								w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+								w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, X-API-Key")
 
 								w.WriteHeader(http.StatusOK)
 								return
@@ -0,0 +1,276 @@
+// Package oidc implements the relying party side of OpenID Connect: discovering an upstream provider's endpoints,
+// building authorization requests, exchanging authorization codes and verifying the ID tokens the provider returns.
+// Only the authorization code flow with PKCE is supported.
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/badrchoubai/services/internal/jwt"
+)
+
+const (
+	// jwksRefreshInterval bounds how often an unknown kid can trigger a refetch of the provider's keys.
+	jwksRefreshInterval = time.Minute
+
+	// maxResponseSize limits how much of a provider response is read.
+	maxResponseSize = 1 << 20
+)
+
+var (
+	// ErrInvalidIDToken is returned when an ID token fails signature or claims verification.
+	ErrInvalidIDToken = errors.New("invalid id token")
+
+	// ErrExchangeFailed is returned when the provider rejects an authorization code.
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+)
+
+// Config identifies a provider and the client registered with it.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Claims are the ID token claims used to identify and provision a user.
+type Claims struct {
+	jwt.RegisteredClaims
+
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	Name            string `json:"name"`
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Provider is an upstream OpenID Connect provider. Its configuration is discovered on first use and its signing keys
+// are cached, so a provider that is unreachable at startup does not prevent the service from starting.
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        *jwt.KeySet
+	keysFetched time.Time
+}
+
+// NewProvider returns a Provider for the given configuration, making requests with client. The issuer must be given
+// exactly as the provider publishes it, since it is compared with the iss claim of every ID token.
+func NewProvider(config Config, client *http.Client) *Provider {
+	return &Provider{config: config, client: client}
+}
+
+// AuthCodeURL returns the provider URL to send the user to, carrying the state, nonce and S256 PKCE challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(md.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("parsing authorization endpoint: %w", err)
+	}
+
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", p.config.RedirectURL)
+	query.Set("scope", strings.Join(p.config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code at the provider's token endpoint and returns the verified claims of the ID
+// token it issues. nonce must be the value passed to AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Claims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("requesting token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchangeFailed, body.Error, body.ErrorDescription)
+	}
+
+	return p.verify(ctx, body.IDToken, nonce)
+}
+
+// verify checks the ID token's signature, issuer, audience, expiry and nonce.
+func (p *Provider) verify(ctx context.Context, idToken, nonce string) (*Claims, error) {
+	keys, err := p.signingKeys(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+
+	err = keys.Verify(idToken, &claims)
+	if errors.Is(err, jwt.ErrUnknownKey) {
+		// The provider may have rotated its keys since they were cached.
+		if keys, err = p.signingKeys(ctx, true); err != nil {
+			return nil, err
+		}
+		err = keys.Verify(idToken, &claims)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	// OpenID Connect requires both claims, but Validate only checks the expiry when one is present.
+	if claims.ExpiresAt == 0 || claims.IssuedAt == 0 {
+		return nil, fmt.Errorf("%w: missing exp or iat", ErrInvalidIDToken)
+	}
+
+	if err := claims.Validate(p.config.Issuer, p.config.ClientID, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, fmt.Errorf("%w: azp does not match client", ErrInvalidIDToken)
+	}
+
+	if claims.Subject == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: missing subject or mismatched nonce", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// discover fetches and caches the provider's configuration document.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	data, err := p.get(ctx, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return nil, fmt.Errorf("discovering provider: %w", err)
+	}
+
+	var md metadata
+	if err := json.Unmarshal(data, &md); err != nil {
+		return nil, fmt.Errorf("discovering provider: %w", err)
+	}
+
+	if md.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovering provider: issuer %q does not match %q", md.Issuer, p.config.Issuer)
+	}
+
+	if md.AuthorizationEndpoint == "" || md.TokenEndpoint == "" || md.JWKSURI == "" {
+		return nil, errors.New("discovering provider: configuration is missing required endpoints")
+	}
+
+	p.metadata = &md
+	return p.metadata, nil
+}
+
+// signingKeys returns the provider's cached keys, fetching them if there are none or if refresh is set and the
+// cache is older than jwksRefreshInterval.
+func (p *Provider) signingKeys(ctx context.Context, refresh bool) (*jwt.KeySet, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && (!refresh || time.Since(p.keysFetched) < jwksRefreshInterval) {
+		return p.keys, nil
+	}
+
+	data, err := p.get(ctx, md.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+
+	keys, err := jwt.ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+
+	p.keys = keys
+	p.keysFetched = time.Now()
+
+	return p.keys, nil
+}
+
+func (p *Provider) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+}
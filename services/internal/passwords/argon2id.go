@@ -0,0 +1,145 @@
+package passwords
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"strings"
+)
+
+const (
+	// argon2SaltLength is the length of generated salts in bytes, as recommended by RFC 9106.
+	argon2SaltLength = 16
+
+	// argon2KeyLength is the length of the derived key in bytes.
+	argon2KeyLength = 32
+)
+
+// Argon2id hashes passwords with argon2id, encoding them as
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>.
+type Argon2id struct {
+	// Memory is the amount of memory used, in KiB.
+	Memory uint32
+
+	// Iterations is the number of passes over the memory.
+	Iterations uint32
+
+	// Parallelism is the number of lanes, and so the number of threads that can be used.
+	Parallelism uint8
+}
+
+// argon2idParams are the parameters recorded in an encoded argon2id hash.
+type argon2idParams struct {
+	Argon2id
+
+	salt []byte
+	key  []byte
+}
+
+func (a *Argon2id) validate() error {
+	if a.Iterations < 1 || a.Parallelism < 1 || a.Memory < 8*uint32(a.Parallelism) {
+		return fmt.Errorf(
+			"invalid argon2id parameters: memory %d KiB, iterations %d, parallelism %d",
+			a.Memory,
+			a.Iterations,
+			a.Parallelism,
+		)
+	}
+
+	return nil
+}
+
+// Name returns "argon2id".
+func (a *Argon2id) Name() string {
+	return AlgorithmArgon2id
+}
+
+// Recognizes reports whether the encoded hash is an argon2id PHC string.
+func (a *Argon2id) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// Hash returns the PHC string of the plaintext password hashed with a new random salt.
+func (a *Argon2id) Hash(plaintext string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(plaintext), salt, a.Iterations, a.Memory, a.Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		a.Memory,
+		a.Iterations,
+		a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify reports whether the plaintext password matches the encoded hash, using the parameters recorded in it.
+func (a *Argon2id) Verify(encoded, plaintext string) (bool, error) {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	key := argon2.IDKey(
+		[]byte(plaintext),
+		params.salt,
+		params.Iterations,
+		params.Memory,
+		params.Parallelism,
+		uint32(len(params.key)),
+	)
+
+	return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+}
+
+// Current reports whether the encoded hash was made with the same parameters as a.
+func (a *Argon2id) Current(encoded string) bool {
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false
+	}
+
+	return params.Argon2id == *a && len(params.salt) == argon2SaltLength && len(params.key) == argon2KeyLength
+}
+
+func decodeArgon2id(encoded string) (*argon2idParams, error) {
+	// The leading "$" leaves an empty first field.
+	fields := strings.Split(encoded, "$")
+	if len(fields) != 6 || fields[1] != AlgorithmArgon2id {
+		return nil, fmt.Errorf("%w: malformed argon2id hash", ErrUnknownHashFormat)
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("%w: unsupported argon2id version", ErrUnknownHashFormat)
+	}
+
+	var params argon2idParams
+
+	_, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed argon2id parameters", ErrUnknownHashFormat)
+	}
+
+	if params.salt, err = base64.RawStdEncoding.DecodeString(fields[4]); err != nil {
+		return nil, fmt.Errorf("%w: malformed argon2id salt", ErrUnknownHashFormat)
+	}
+
+	if params.key, err = base64.RawStdEncoding.DecodeString(fields[5]); err != nil || len(params.key) == 0 {
+		return nil, fmt.Errorf("%w: malformed argon2id hash", ErrUnknownHashFormat)
+	}
+
+	if err := params.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnknownHashFormat, err)
+	}
+
+	return &params, nil
+}
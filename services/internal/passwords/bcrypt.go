@@ -0,0 +1,62 @@
+package passwords
+
+import (
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+// Bcrypt hashes passwords with bcrypt, encoding them in the $2a$, $2b$ or $2y$ modular crypt format bcrypt hashes
+// have always used, which PHC strings are modelled on.
+type Bcrypt struct {
+	// Cost is the base-2 logarithm of the number of key expansion rounds.
+	Cost int
+}
+
+func (b *Bcrypt) validate() error {
+	if b.Cost < bcrypt.MinCost || b.Cost > bcrypt.MaxCost {
+		return fmt.Errorf("invalid bcrypt cost %d", b.Cost)
+	}
+
+	return nil
+}
+
+// Name returns "bcrypt".
+func (b *Bcrypt) Name() string {
+	return AlgorithmBcrypt
+}
+
+// Recognizes reports whether the encoded hash is a bcrypt hash.
+func (b *Bcrypt) Recognizes(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Hash returns the bcrypt hash of the plaintext password.
+func (b *Bcrypt) Hash(plaintext string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), b.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// Verify reports whether the plaintext password matches the encoded hash.
+func (b *Bcrypt) Verify(encoded, plaintext string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(plaintext))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Current reports whether the encoded hash was made with the same cost as b.
+func (b *Bcrypt) Current(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err == nil && cost == b.Cost
+}
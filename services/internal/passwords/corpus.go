@@ -0,0 +1,193 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1" // #nosec G505 -- breached password corpora are published as SHA-1 hashes
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// prefixLength is the number of hex digits of a hash used to select a range, as in the k-anonymity range API
+	// breached password corpora are published for.
+	prefixLength = 5
+
+	// hashLength is the number of hex digits in a SHA-1 hash.
+	hashLength = 2 * sha1.Size
+)
+
+// ErrInvalidCorpus is returned when a breached password corpus is not in the expected format.
+var ErrInvalidCorpus = errors.New("invalid breached password corpus")
+
+// Corpus is an offline corpus of breached password hashes, such as the Pwned Passwords list ordered by hash. The file
+// holds one uppercase SHA-1 hash per line, optionally followed by a colon and a count, sorted by hash.
+//
+// Lookups mirror the k-anonymity range API: the range of hashes sharing the password hash's five digit prefix is
+// located by binary search and scanned for the remaining digits, so the corpus is never loaded into memory.
+type Corpus struct {
+	path string
+}
+
+// OpenCorpus checks that the file at path looks like a breached password corpus and returns a Corpus reading from
+// it. The file is opened and measured again for each lookup, so it can be replaced while the service is running.
+func OpenCorpus(path string) (*Corpus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	if _, ok := parseCorpusLine(line); !ok {
+		return nil, fmt.Errorf("%w: %s: first line is not a SHA-1 hash", ErrInvalidCorpus, path)
+	}
+
+	return &Corpus{path: path}, nil
+}
+
+// Contains reports whether the password's hash is in the corpus.
+func (c *Corpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password)) // #nosec G401 -- matching the corpus, not protecting the password
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	f, err := os.Open(c.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// The size is taken from the file just opened rather than remembered, since the corpus may have been replaced by
+	// a file of a different length since the last lookup.
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	cf := &corpusFile{f: f, path: c.path, size: info.Size()}
+
+	suffixes, err := cf.rangeOf(hash[:prefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	for _, suffix := range suffixes {
+		if suffix == hash[prefixLength:] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// corpusFile is a corpus file opened for a single lookup, along with its size at the time.
+type corpusFile struct {
+	f    *os.File
+	path string
+	size int64
+}
+
+// rangeOf returns the suffixes of every hash in the corpus beginning with prefix.
+func (c *corpusFile) rangeOf(prefix string) ([]string, error) {
+	// Find the smallest offset whose following line sorts at or after the prefix; since the file is sorted, that line
+	// starts the range.
+	lo, hi := int64(0), c.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		hash, err := c.hashAfter(mid)
+		if err != nil {
+			return nil, err
+		}
+
+		if hash == "" || hash[:prefixLength] >= prefix {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	r, err := c.linesAfter(lo)
+	if err != nil {
+		return nil, err
+	}
+
+	var suffixes []string
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		hash, ok := parseCorpusLine(line)
+		if !ok || hash[:prefixLength] != prefix {
+			return suffixes, nil
+		}
+		suffixes = append(suffixes, hash[prefixLength:])
+
+		if errors.Is(err, io.EOF) {
+			return suffixes, nil
+		}
+	}
+}
+
+// hashAfter returns the hash on the first line starting at or after offset, or an empty string if there is none.
+func (c *corpusFile) hashAfter(offset int64) (string, error) {
+	r, err := c.linesAfter(offset)
+	if err != nil {
+		return "", err
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	if line == "" {
+		return "", nil
+	}
+
+	hash, ok := parseCorpusLine(line)
+	if !ok {
+		return "", fmt.Errorf("%w: %s: malformed line near offset %d", ErrInvalidCorpus, c.path, offset)
+	}
+
+	return hash, nil
+}
+
+// linesAfter returns a reader positioned at the first line starting at or after offset.
+func (c *corpusFile) linesAfter(offset int64) (*bufio.Reader, error) {
+	if offset == 0 {
+		return bufio.NewReader(io.NewSectionReader(c.f, 0, c.size)), nil
+	}
+
+	// A line starts at offset exactly when the byte before it ends the previous line.
+	r := bufio.NewReader(io.NewSectionReader(c.f, offset-1, c.size-offset+1))
+	if _, err := r.ReadString('\n'); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// parseCorpusLine returns the uppercased hash from a corpus line, ignoring any count that follows it.
+func parseCorpusLine(line string) (string, bool) {
+	hash, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+	if len(hash) != hashLength {
+		return "", false
+	}
+
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+
+	return strings.ToUpper(hash), true
+}
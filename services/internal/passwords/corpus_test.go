@@ -0,0 +1,167 @@
+package passwords
+
+import (
+	"crypto/sha1" // #nosec G505 -- breached password corpora are published as SHA-1 hashes
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// corpusEntry is a password and its hash in the form a corpus lists it.
+type corpusEntry struct {
+	password string
+	hash     string
+}
+
+// writeCorpus writes a sorted corpus of the given passwords' hashes to a temporary file, alternating lines with and
+// without counts, and returns its path along with the entries in corpus order.
+func writeCorpus(t *testing.T, passwords []string) (string, []corpusEntry) {
+	t.Helper()
+
+	entries := make([]corpusEntry, 0, len(passwords))
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password)) // #nosec G401 -- building a corpus, not protecting the password
+		entries = append(entries, corpusEntry{password: password, hash: strings.ToUpper(hex.EncodeToString(sum[:]))})
+	}
+	slices.SortFunc(entries, func(a, b corpusEntry) int { return strings.Compare(a.hash, b.hash) })
+
+	var b strings.Builder
+	for i, e := range entries {
+		if i%2 == 0 {
+			fmt.Fprintf(&b, "%s:%d\r\n", e.hash, i+1)
+		} else {
+			fmt.Fprintf(&b, "%s\n", e.hash)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "corpus.txt")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, entries
+}
+
+func TestCorpusContains(t *testing.T) {
+	passwords := make([]string, 500)
+	for i := range passwords {
+		passwords[i] = fmt.Sprintf("breached-%d", i)
+	}
+
+	path, entries := writeCorpus(t, passwords)
+
+	corpus, err := OpenCorpus(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		want     bool
+	}{
+		{name: "first line", password: entries[0].password, want: true},
+		{name: "second line", password: entries[1].password, want: true},
+		{name: "middle line", password: entries[len(entries)/2].password, want: true},
+		{name: "next to last line", password: entries[len(entries)-2].password, want: true},
+		{name: "last line", password: entries[len(entries)-1].password, want: true},
+		{name: "not listed", password: "never-breached", want: false},
+		{name: "empty", password: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := corpus.Contains(tt.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+	// Every entry is found, whichever of the line formats it was written in.
+	for _, e := range entries {
+		if got, err := corpus.Contains(e.password); err != nil || !got {
+			t.Fatalf("%s: got %t and %v, want it found", e.password, got, err)
+		}
+	}
+}
+
+func TestCorpusSingleLine(t *testing.T) {
+	path, _ := writeCorpus(t, []string{"only"})
+
+	corpus, err := OpenCorpus(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for password, want := range map[string]bool{"only": true, "other": false} {
+		if got, err := corpus.Contains(password); err != nil || got != want {
+			t.Errorf("%s: got %t and %v, want %t", password, got, err, want)
+		}
+	}
+}
+
+func TestOpenCorpusInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "empty", data: ""},
+		{name: "plain passwords", data: "password\nletmein\n"},
+		{name: "short hash", data: "5BAA6:3\n"},
+		{name: "not hex", data: strings.Repeat("Z", hashLength) + ":1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "corpus.txt")
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := OpenCorpus(path); !errors.Is(err, ErrInvalidCorpus) {
+				t.Errorf("got %v, want %v", err, ErrInvalidCorpus)
+			}
+		})
+	}
+
+	if _, err := OpenCorpus(filepath.Join(t.TempDir(), "missing.txt")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: got %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestParseCorpusLine(t *testing.T) {
+	const hash = "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8"
+
+	tests := []struct {
+		name   string
+		line   string
+		want   string
+		wantOK bool
+	}{
+		{name: "hash", line: hash + "\n", want: hash, wantOK: true},
+		{name: "count", line: hash + ":3861493\n", want: hash, wantOK: true},
+		{name: "carriage return", line: hash + ":42\r\n", want: hash, wantOK: true},
+		{name: "lowercase", line: strings.ToLower(hash) + ":1\n", want: hash, wantOK: true},
+		{name: "empty", line: "", wantOK: false},
+		{name: "truncated", line: hash[:hashLength-1] + "\n", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseCorpusLine(tt.line)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %q and %t, want %q and %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
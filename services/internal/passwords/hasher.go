@@ -0,0 +1,135 @@
+package passwords
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/badrchoubai/services/internal/config"
+)
+
+const (
+	// AlgorithmArgon2id hashes passwords with argon2id, as recommended by RFC 9106.
+	AlgorithmArgon2id = "argon2id"
+
+	// AlgorithmBcrypt hashes passwords with bcrypt.
+	AlgorithmBcrypt = "bcrypt"
+)
+
+// ErrUnknownHashFormat is returned when a stored hash was not produced by any supported algorithm.
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Algorithm is a password hashing scheme producing self-describing hashes in PHC string format, which record the
+// algorithm and parameters alongside the salt and hash so that they can be verified after the parameters change.
+type Algorithm interface {
+	// Name returns the identifier of the algorithm.
+	Name() string
+
+	// Recognizes reports whether the encoded hash was produced by this algorithm.
+	Recognizes(encoded string) bool
+
+	// Hash returns the encoded hash of the plaintext password with a new random salt.
+	Hash(plaintext string) (string, error)
+
+	// Verify reports whether the plaintext password matches the encoded hash.
+	Verify(encoded, plaintext string) (bool, error)
+
+	// Current reports whether the encoded hash was made with the algorithm's present parameters.
+	Current(encoded string) bool
+}
+
+// Hasher hashes new passwords with its preferred algorithm and verifies hashes made by any supported algorithm, so
+// that the preferred algorithm and its parameters can change without invalidating existing passwords.
+type Hasher struct {
+	preferred  Algorithm
+	algorithms []Algorithm
+
+	dummyOnce sync.Once
+	dummy     string
+	dummyErr  error
+}
+
+// NewHasher returns a Hasher preferring the configured algorithm and cost parameters.
+func NewHasher(cfg config.Config) (*Hasher, error) {
+	argon2id := &Argon2id{
+		Memory:      uint32(cfg.PasswordArgon2Memory()),
+		Iterations:  uint32(cfg.PasswordArgon2Iterations()),
+		Parallelism: uint8(cfg.PasswordArgon2Parallelism()),
+	}
+	bcrypt := &Bcrypt{Cost: cfg.PasswordBcryptCost()}
+
+	if err := argon2id.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.validate(); err != nil {
+		return nil, err
+	}
+
+	switch cfg.PasswordHashAlgorithm() {
+	case AlgorithmArgon2id:
+		return NewHasherWith(argon2id, bcrypt), nil
+	case AlgorithmBcrypt:
+		return NewHasherWith(bcrypt, argon2id), nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.PasswordHashAlgorithm())
+	}
+}
+
+// NewHasherWith returns a Hasher that hashes with preferred and also verifies hashes made by any of others.
+func NewHasherWith(preferred Algorithm, others ...Algorithm) *Hasher {
+	return &Hasher{
+		preferred:  preferred,
+		algorithms: append([]Algorithm{preferred}, others...),
+	}
+}
+
+// Hash returns the encoded hash of the plaintext password made with the preferred algorithm.
+func (h *Hasher) Hash(plaintext string) (string, error) {
+	return h.preferred.Hash(plaintext)
+}
+
+// Verify reports whether the plaintext password matches the encoded hash. On a match, rehash reports whether the
+// hash should be replaced because it was made with an algorithm or parameters other than the preferred ones.
+func (h *Hasher) Verify(encoded, plaintext string) (match, rehash bool, err error) {
+	for _, algorithm := range h.algorithms {
+		if !algorithm.Recognizes(encoded) {
+			continue
+		}
+
+		match, err := algorithm.Verify(encoded, plaintext)
+		if err != nil || !match {
+			return false, false, err
+		}
+
+		return true, algorithm != h.preferred || !algorithm.Current(encoded), nil
+	}
+
+	return false, false, fmt.Errorf("%w: %q", ErrUnknownHashFormat, prefixOf(encoded))
+}
+
+// VerifyDummy performs a throwaway verification costing the same as one against a hash made with the preferred
+// algorithm, so that logins for unknown accounts cannot be told apart by response time.
+func (h *Hasher) VerifyDummy(plaintext string) error {
+	h.dummyOnce.Do(func() {
+		h.dummy, h.dummyErr = h.preferred.Hash("dummy-password")
+	})
+
+	if h.dummyErr != nil {
+		return h.dummyErr
+	}
+
+	_, err := h.preferred.Verify(h.dummy, plaintext)
+	return err
+}
+
+// prefixOf returns the identifier of an encoded hash for use in error messages, without revealing the hash itself.
+func prefixOf(encoded string) string {
+	if !strings.HasPrefix(encoded, "$") {
+		return ""
+	}
+
+	id, _, _ := strings.Cut(encoded[1:], "$")
+	return id
+}
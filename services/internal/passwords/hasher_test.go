@@ -0,0 +1,217 @@
+package passwords
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast; the hashes are still real argon2id and bcrypt hashes.
+var (
+	testArgon2id = &Argon2id{Memory: 64, Iterations: 1, Parallelism: 1}
+	testBcrypt   = &Bcrypt{Cost: bcrypt.MinCost}
+)
+
+func TestAlgorithmRoundTrip(t *testing.T) {
+	tests := []struct {
+		algorithm Algorithm
+		prefix    string
+	}{
+		{algorithm: testArgon2id, prefix: "$argon2id$v=19$m=64,t=1,p=1$"},
+		{algorithm: testBcrypt, prefix: "$2a$04$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.algorithm.Name(), func(t *testing.T) {
+			encoded, err := tt.algorithm.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.HasPrefix(encoded, tt.prefix) {
+				t.Fatalf("got %s, want a hash beginning %s", encoded, tt.prefix)
+			}
+
+			if !tt.algorithm.Recognizes(encoded) || !tt.algorithm.Current(encoded) {
+				t.Errorf("%s is not recognized as a current hash", encoded)
+			}
+
+			if match, err := tt.algorithm.Verify(encoded, "correct horse"); err != nil || !match {
+				t.Errorf("verifying the password: got %t and %v, want a match", match, err)
+			}
+
+			if match, err := tt.algorithm.Verify(encoded, "wrong horse"); err != nil || match {
+				t.Errorf("verifying another password: got %t and %v, want no match", match, err)
+			}
+
+			// Each hash has its own salt.
+			again, err := tt.algorithm.Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if again == encoded {
+				t.Error("hashing the same password twice gave the same hash")
+			}
+		})
+	}
+}
+
+func TestDecodeArgon2id(t *testing.T) {
+	encoded, err := testArgon2id.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params, err := decodeArgon2id(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params.Argon2id != *testArgon2id || len(params.salt) != argon2SaltLength || len(params.key) != argon2KeyLength {
+		t.Errorf("got %+v, want the parameters it was hashed with", params)
+	}
+}
+
+func TestHasherVerifyRehash(t *testing.T) {
+	argon2Hash, err := testArgon2id.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bcryptHash, err := testBcrypt.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		hasher     *Hasher
+		encoded    string
+		wantRehash bool
+	}{
+		{
+			name:       "argon2id is current",
+			hasher:     NewHasherWith(testArgon2id, testBcrypt),
+			encoded:    argon2Hash,
+			wantRehash: false,
+		},
+		{
+			name:       "bcrypt is current",
+			hasher:     NewHasherWith(testBcrypt, testArgon2id),
+			encoded:    bcryptHash,
+			wantRehash: false,
+		},
+		{
+			name:       "bcrypt when argon2id is preferred",
+			hasher:     NewHasherWith(testArgon2id, testBcrypt),
+			encoded:    bcryptHash,
+			wantRehash: true,
+		},
+		{
+			name:       "argon2id when bcrypt is preferred",
+			hasher:     NewHasherWith(testBcrypt, testArgon2id),
+			encoded:    argon2Hash,
+			wantRehash: true,
+		},
+		{
+			name:       "argon2id memory raised",
+			hasher:     NewHasherWith(&Argon2id{Memory: 128, Iterations: 1, Parallelism: 1}),
+			encoded:    argon2Hash,
+			wantRehash: true,
+		},
+		{
+			name:       "argon2id iterations raised",
+			hasher:     NewHasherWith(&Argon2id{Memory: 64, Iterations: 2, Parallelism: 1}),
+			encoded:    argon2Hash,
+			wantRehash: true,
+		},
+		{
+			name:       "bcrypt cost raised",
+			hasher:     NewHasherWith(&Bcrypt{Cost: bcrypt.MinCost + 1}),
+			encoded:    bcryptHash,
+			wantRehash: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := tt.hasher.Verify(tt.encoded, "correct horse")
+			if err != nil || !match {
+				t.Fatalf("got %t and %v, want a match", match, err)
+			}
+
+			if rehash != tt.wantRehash {
+				t.Errorf("got rehash %t, want %t", rehash, tt.wantRehash)
+			}
+
+			// A wrong password never asks for a rehash.
+			match, rehash, err = tt.hasher.Verify(tt.encoded, "wrong horse")
+			if err != nil || match || rehash {
+				t.Errorf("wrong password: got %t, %t and %v, want no match", match, rehash, err)
+			}
+		})
+	}
+}
+
+func TestHasherVerifyMalformed(t *testing.T) {
+	hasher := NewHasherWith(testArgon2id, testBcrypt)
+
+	const (
+		salt = "c29tZXNhbHRzb21lc2FsdA"
+		key  = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	)
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "empty", encoded: ""},
+		{name: "plaintext", encoded: "correct horse"},
+		{name: "unknown algorithm", encoded: "$scrypt$ln=15,r=8,p=1$" + salt + "$" + key},
+		{name: "argon2id prefix only", encoded: "$argon2id$"},
+		{name: "argon2id missing hash", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{name: "argon2id extra field", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key + "$"},
+		{name: "argon2id old version", encoded: "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "argon2id bad version", encoded: "$argon2id$v=x$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "argon2id bad parameters", encoded: "$argon2id$v=19$m=64,t=1$" + salt + "$" + key},
+		{name: "argon2id parallelism overflows", encoded: "$argon2id$v=19$m=64,t=1,p=256$" + salt + "$" + key},
+		{name: "argon2id zero iterations", encoded: "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{name: "argon2id zero parallelism", encoded: "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key},
+		{name: "argon2id too little memory", encoded: "$argon2id$v=19$m=1,t=1,p=1$" + salt + "$" + key},
+		{name: "argon2id bad salt", encoded: "$argon2id$v=19$m=64,t=1,p=1$!!!$" + key},
+		{name: "argon2id bad hash", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$!!!"},
+		{name: "argon2id empty hash", encoded: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+		{name: "bcrypt truncated", encoded: "$2a$04$short"},
+		{name: "bcrypt bad cost", encoded: "$2a$xx$" + strings.Repeat("a", 53)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := hasher.Verify(tt.encoded, "correct horse")
+			if err == nil || match || rehash {
+				t.Errorf("got %t, %t and %v, want an error", match, rehash, err)
+			}
+		})
+	}
+
+	// Hashes no algorithm recognizes are reported by their identifier alone.
+	_, _, err := hasher.Verify("$scrypt$ln=15,r=8,p=1$"+salt+"$"+key, "correct horse")
+	if !errors.Is(err, ErrUnknownHashFormat) || strings.Contains(err.Error(), salt) {
+		t.Errorf("got %v, want %v naming only the algorithm", err, ErrUnknownHashFormat)
+	}
+}
+
+func TestHasherVerifyDummy(t *testing.T) {
+	hasher := NewHasherWith(testArgon2id)
+
+	if err := hasher.VerifyDummy("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hasher.dummy, "$argon2id$") {
+		t.Errorf("got dummy hash %s, want one made with the preferred algorithm", hasher.dummy)
+	}
+}
@@ -0,0 +1,106 @@
+// Package passwords enforces the rules new passwords must satisfy and hashes them for storage. A Policy checks length
+// limits, a list of common passwords embedded in the binary and, optionally, an offline corpus of passwords exposed in
+// data breaches, reporting violations as field-level errors on a validator.Validator. A Hasher stores passwords as
+// self-describing argon2id or bcrypt hashes and reports when a stored hash should be upgraded.
+package passwords
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+
+	"github.com/badrchoubai/services/internal/config"
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+// bcryptMaxLength is the number of bytes bcrypt hashes; anything beyond it is silently ignored, so longer passwords
+// are refused rather than truncated.
+const bcryptMaxLength = 72
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords is the set of lowercased passwords from commonPasswordsFile.
+var commonPasswords = parseCommonPasswords(commonPasswordsFile)
+
+func parseCommonPasswords(data string) map[string]struct{} {
+	passwords := make(map[string]struct{})
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[strings.ToLower(line)] = struct{}{}
+	}
+
+	return passwords
+}
+
+// Policy holds the rules a new password is checked against.
+type Policy struct {
+	MinLength    int
+	MaxLength    int
+	RejectCommon bool
+
+	// Breached is checked for passwords exposed in data breaches. A nil corpus disables the check.
+	Breached *Corpus
+}
+
+// NewPolicy returns the policy described by the configuration, opening the breached password corpus if one is
+// configured. The maximum length is capped at what bcrypt can hash.
+func NewPolicy(cfg config.Config) (*Policy, error) {
+	policy := &Policy{
+		MinLength:    cfg.PasswordMinLength(),
+		MaxLength:    min(cfg.PasswordMaxLength(), bcryptMaxLength),
+		RejectCommon: cfg.PasswordRejectCommon(),
+	}
+
+	if policy.MinLength < 1 || policy.MinLength > policy.MaxLength {
+		return nil, fmt.Errorf(
+			"password minimum length %d must be between 1 and the maximum length %d",
+			policy.MinLength,
+			policy.MaxLength,
+		)
+	}
+
+	if path := cfg.PasswordBreachedCorpus(); path != "" {
+		corpus, err := OpenCorpus(path)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = corpus
+	}
+
+	return policy, nil
+}
+
+// Validate checks a new password against the policy, recording any violation on v under key. The returned error
+// reports a failure to consult the breached password corpus, not a policy violation.
+func (p *Policy) Validate(v *validator.Validator, key, password string) error {
+	v.Check(password != "", key, "must be provided")
+	v.Check(len(password) >= p.MinLength, key, fmt.Sprintf("must be at least %d bytes long", p.MinLength))
+	v.Check(len(password) <= p.MaxLength, key, fmt.Sprintf("must not be more than %d bytes long", p.MaxLength))
+
+	// The lists are only worth consulting for a password that is otherwise acceptable.
+	if _, failed := v.Errors[key]; failed {
+		return nil
+	}
+
+	if p.RejectCommon {
+		if _, common := commonPasswords[strings.ToLower(password)]; common {
+			v.AddError(key, "is too common, please choose another")
+			return nil
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return err
+		}
+		v.Check(!breached, key, "has appeared in a data breach, please choose another")
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+func TestPolicyValidate(t *testing.T) {
+	corpusPath, _ := writeCorpus(t, []string{"breached password", "another leak"})
+
+	corpus, err := OpenCorpus(corpusPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &Policy{MinLength: 8, MaxLength: bcryptMaxLength, RejectCommon: true, Breached: corpus}
+
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{name: "acceptable", password: "correct horse battery staple", want: ""},
+		{name: "empty", password: "", want: "must be provided"},
+		{name: "too short", password: "short", want: "must be at least 8 bytes long"},
+		{name: "at the bcrypt limit", password: strings.Repeat("x", 71) + "y", want: ""},
+		{name: "over the bcrypt limit", password: strings.Repeat("x", 72) + "y", want: "must not be more than 72 bytes long"},
+		{name: "multibyte over the limit", password: strings.Repeat("é", 37), want: "must not be more than 72 bytes long"},
+		{name: "common", password: "password", want: "is too common, please choose another"},
+		{name: "common in another case", password: "PassWord", want: "is too common, please choose another"},
+		{name: "breached", password: "breached password", want: "has appeared in a data breach, please choose another"},
+		{name: "breached is case-sensitive", password: "Breached Password", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			if err := policy.Validate(v, "password", tt.password); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := v.Errors["password"]; got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyOptionalChecks(t *testing.T) {
+	policy := &Policy{MinLength: 8, MaxLength: bcryptMaxLength}
+
+	// With neither list enabled, only the length limits apply.
+	for _, password := range []string{"password", "breached password"} {
+		v := validator.New()
+		if err := policy.Validate(v, "password", password); err != nil {
+			t.Fatal(err)
+		}
+
+		if !v.Valid() {
+			t.Errorf("%s: got %v, want no errors", password, v.Errors)
+		}
+	}
+}
+
+func TestCommonPasswords(t *testing.T) {
+	if len(commonPasswords) < 100 {
+		t.Fatalf("got %d common passwords, want the embedded list", len(commonPasswords))
+	}
+
+	for _, password := range []string{"123456", "password", "qwerty"} {
+		if _, ok := commonPasswords[password]; !ok {
+			t.Errorf("%s is missing from the common password list", password)
+		}
+	}
+
+	for password := range commonPasswords {
+		if strings.HasPrefix(password, "#") || password != strings.ToLower(strings.TrimSpace(password)) {
+			t.Errorf("got %q, want comments skipped and entries trimmed and lowercased", password)
+		}
+	}
+
+	got := parseCommonPasswords("# comment\n\n  Hunter2 \r\nletmein\n")
+	if len(got) != 2 {
+		t.Fatalf("got %d passwords, want 2", len(got))
+	}
+
+	for _, password := range []string{"hunter2", "letmein"} {
+		if _, ok := got[password]; !ok {
+			t.Errorf("%s is missing", password)
+		}
+	}
+}
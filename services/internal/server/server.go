@@ -48,7 +48,7 @@ func NewServer(cfg *config.AppConfig, opts ...Option) *Server {
 	server = server.WithOptions(opts...)
 
 	for _, svc := range server.services {
-		server.mux.Handle(svc.Path()+"/", http.StripPrefix(svc.Path(), svc.Mux())) // Register with service Path prefix
+		server.mux.Handle(svc.Path()+"/", http.StripPrefix(svc.Path(), svc.Handler())) // Register with service Path prefix
 	}
 
 	server.httpServer.Handler = server.ApplyMiddleware(server.mux)
@@ -137,7 +137,8 @@ func (s *Server) Serve() error {
 	return nil
 }
 
-// Shutdown gracefully shuts down the HTTP server, allowing existing connections to finish.
+// Shutdown gracefully shuts down the HTTP server, allowing existing connections to finish,
+// then waits for background work started by each registered service to complete.
 // It logs the shutdown event and returns any error encountered during the shutdown process.
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("HTTP server shut down")
@@ -147,5 +148,20 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		return err
 	}
 
+	done := make(chan struct{})
+	go func() {
+		for _, svc := range s.services {
+			svc.Wait()
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.logger.Info("background tasks completed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
 	return nil
 }
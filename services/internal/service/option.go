@@ -3,6 +3,7 @@ package service
 import (
 	_ "github.com/lib/pq" // Register Postgres driver for database access
 	"go.uber.org/zap"
+	"net/http"
 
 	"github.com/badrchoubai/services/internal/database"
 )
@@ -35,6 +36,15 @@ func WithLogger(logger *zap.Logger) Option {
 	})
 }
 
+// WithMiddleware returns an Option that adds one or more middleware functions
+// to a Service instance. The middleware wraps every route registered on the
+// Service's mux, with the first middleware provided becoming the outermost.
+func WithMiddleware(middleware ...func(http.Handler) http.Handler) Option {
+	return optionFunc(func(s *Service) {
+		s.middlewares = append(s.middlewares, middleware...)
+	})
+}
+
 // WithOptions clones the current Service, applies the supplied list of Option, and
 // returns the resulting Service. It's safe to use concurrently.
 func (svc *Service) WithOptions(opts ...Option) *Service {
@@ -27,6 +27,7 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/badrchoubai/services/internal/database"
 	"github.com/badrchoubai/services/internal/encoding"
@@ -40,11 +41,13 @@ type Service struct {
 	name           string
 	path           string
 	encoderDecoder encoding.EncoderDecoder
+	background     *sync.WaitGroup
 
 	// These values are applied by WithOptions
-	database *database.Database
-	logger   *zap.Logger
-	mux      *http.ServeMux
+	database    *database.Database
+	logger      *zap.Logger
+	middlewares []func(http.Handler) http.Handler
+	mux         *http.ServeMux
 }
 
 var (
@@ -57,7 +60,13 @@ type IService interface {
 	Name() string
 	WithOptions(opts ...Option) *Service
 
+	Background(fn func())
+	Wait()
+
+	Database() *database.Database
 	EncoderDecoder() encoding.EncoderDecoder
+	Handler() http.Handler
+	Logger() *zap.Logger
 	Mux() *http.ServeMux
 
 	clone() *Service
@@ -76,13 +85,14 @@ func NewService(ctx context.Context, name string, options ...Option) (*Service,
 	}
 
 	svc := &Service{
+		background:     &sync.WaitGroup{},
 		ctx:            ctx,
 		encoderDecoder: encoding.NewEncoderDecoder(),
 		mux:            http.NewServeMux(),
 		name:           name,
 		path:           path,
 	}
-	svc.WithOptions(options...)
+	svc = svc.WithOptions(options...)
 
 	return svc, nil
 }
@@ -116,11 +126,54 @@ func makePathFromName(name string) (string, error) {
 	return path, nil
 }
 
+// Background runs fn in a new goroutine that Wait blocks on, recovering and logging any panic it raises. Use it for
+// work, such as sending email, that should outlive the request that started it but not the service.
+func (svc *Service) Background(fn func()) {
+	svc.background.Add(1)
+
+	go func() {
+		defer svc.background.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				svc.logger.Error("background task panicked", zap.Any("panic", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// Wait blocks until every function started with Background has returned.
+func (svc *Service) Wait() {
+	svc.background.Wait()
+}
+
+// Database returns the service database.Database
+func (svc *Service) Database() *database.Database {
+	return svc.database
+}
+
 // EncoderDecoder returns the service encoding.EncoderDecoder
 func (svc *Service) EncoderDecoder() encoding.EncoderDecoder {
 	return svc.encoderDecoder
 }
 
+// Handler returns the service http.ServeMux wrapped in the middleware supplied through WithMiddleware
+func (svc *Service) Handler() http.Handler {
+	var handler http.Handler = svc.mux
+	for i := len(svc.middlewares) - 1; i >= 0; i-- {
+		handler = svc.middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// Logger returns the service zap.Logger
+func (svc *Service) Logger() *zap.Logger {
+	return svc.logger
+}
+
 // Mux returns the service http.ServeMux
 func (svc *Service) Mux() *http.ServeMux {
 	return svc.mux
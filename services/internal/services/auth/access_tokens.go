@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/tomasen/realip"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/badrchoubai/services/internal/jwt"
+	"github.com/badrchoubai/services/internal/middleware"
+)
+
+const (
+	// accessTokenFormatOpaque issues random bearer tokens whose hashes are stored in the tokens table.
+	accessTokenFormatOpaque = "opaque"
+
+	// accessTokenFormatJWT issues signed, self-contained JWTs that are verified without a database lookup.
+	accessTokenFormatJWT = "jwt"
+)
+
+// tokenPair is the response body of endpoints that log a user in.
+type tokenPair struct {
+	AuthenticationToken *Token `json:"authenticationToken"`
+	RefreshToken        *Token `json:"refreshToken"`
+}
+
+// issueTokenPair issues an access token and a refresh token for the user within a token family. A nil family starts
+// a new one, as happens on login; parent is the hash of the refresh token being rotated, if any.
+func (h *handler) issueTokenPair(r *http.Request, user *User, family, parent []byte) (*tokenPair, error) {
+	if family == nil {
+		var err error
+		if family, err = newTokenFamily(); err != nil {
+			return nil, err
+		}
+	}
+
+	accessToken, err := h.newAccessToken(r, user, family)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := h.newSessionToken(r, user.ID, refreshTokenTTL, ScopeRefresh, family, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenPair{
+		AuthenticationToken: accessToken,
+		RefreshToken:        refreshToken,
+	}, nil
+}
+
+// newSessionToken generates and stores a token within a family, recording the client it was issued to.
+func (h *handler) newSessionToken(
+	r *http.Request,
+	userID int64,
+	ttl time.Duration,
+	scope string,
+	family, parent []byte,
+) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Family = family
+	token.Parent = parent
+	token.IP = realip.FromRequest(r)
+	token.UserAgent = r.UserAgent()
+
+	err = h.tokens.Insert(r.Context(), token)
+	return token, err
+}
+
+// newAccessToken issues an access token for the user in the configured format. Opaque tokens are stored in the
+// given family so that revoking the family also revokes them; JWTs carry the family as their sid claim.
+func (h *handler) newAccessToken(r *http.Request, user *User, family []byte) (*Token, error) {
+	if h.config.AccessTokenFormat() != accessTokenFormatJWT {
+		return h.newSessionToken(r, user.ID, authenticationTokenTTL, ScopeAuthentication, family, nil)
+	}
+
+	permissions, err := h.permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	expiry := now.Add(h.config.JWTTTL())
+
+	claims := middleware.AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    h.config.JWTIssuer(),
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Audience:  jwt.Audience{h.config.JWTAudience()},
+			ExpiresAt: expiry.Unix(),
+			NotBefore: now.Unix(),
+			IssuedAt:  now.Unix(),
+			ID:        hex.EncodeToString(jti),
+		},
+		Name:        user.Name,
+		Email:       user.Email,
+		Activated:   user.Activated,
+		Permissions: permissions,
+		SessionID:   hex.EncodeToString(family),
+	}
+
+	signed, err := h.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		Plaintext: signed,
+		UserID:    user.ID,
+		Expiry:    expiry,
+		Scope:     ScopeAuthentication,
+	}, nil
+}
+
+func (h *handler) showJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := h.encoderDecoder.EncodeResponse(w, http.StatusOK, h.keys.JWKS()); err != nil {
+		h.logError(r, err)
+	}
+}
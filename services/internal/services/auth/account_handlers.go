@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"github.com/tomasen/realip"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+
+	"github.com/badrchoubai/services/internal/encoding"
+	"github.com/badrchoubai/services/internal/middleware"
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+// deletedUserPurgeInterval is how often accounts whose deletion grace period has passed are purged.
+const deletedUserPurgeInterval = time.Hour
+
+// updateCurrentUser changes the logged in user's profile. Fields absent from the request are left as they are.
+func (h *handler) updateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name encoding.Optional[string] `json:"name"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := h.users.Get(r.Context(), middleware.ContextGetUser(r).ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !h.checkUserPrecondition(w, r, user) {
+		return
+	}
+
+	v := validator.New()
+
+	if input.Name.Set {
+		v.Check(!input.Name.Null, "name", "must not be null")
+		user.Name = input.Name.Value
+	}
+
+	if ValidateUser(v, user); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !h.updateUser(w, r, user) {
+		return
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionUserUpdate, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	h.encodeUser(w, r, http.StatusOK, user)
+}
+
+// deleteCurrentUser deletes the logged in user's account once they have re-entered their password. Every credential
+// they hold is revoked straight away, but the account itself is only marked deleted until the configured grace period
+// has passed, during which an administrator can restore it.
+func (h *handler) deleteCurrentUser(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if ValidatePasswordPlaintext(v, input.Password); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := h.users.Get(r.Context(), middleware.ContextGetUser(r).ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !h.checkUserPrecondition(w, r, user) {
+		return
+	}
+
+	if !h.confirmPassword(w, r, user, input.Password) {
+		return
+	}
+
+	gracePeriod := h.config.AccountDeletionGracePeriod()
+
+	if gracePeriod <= 0 {
+		if err := h.users.Delete(r.Context(), user.ID); err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+
+		h.audit(r, &AuditEvent{Action: AuditActionAccountDelete, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+		h.encode(w, r, http.StatusOK, envelope{"message": "your account has been deleted"})
+		return
+	}
+
+	now := time.Now()
+	user.DeletedAt = &now
+
+	if !h.updateUser(w, r, user) {
+		return
+	}
+
+	if err := h.tokens.DeleteAllScopesForUser(r.Context(), user.ID); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionAccountDelete, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	h.sendEmail(user.Email, "security_notice.tmpl", map[string]any{
+		"Name": user.Name,
+		"Event": "Your account was deleted. It will be permanently removed on " +
+			now.Add(gracePeriod).UTC().Format(time.RFC1123) + ".",
+		"Time": now.UTC().Format(time.RFC1123),
+		"IP":   realip.FromRequest(r),
+	})
+
+	message := "your account has been deleted and will be permanently removed at the end of the grace period"
+	h.encode(w, r, http.StatusAccepted, envelope{"message": message})
+}
+
+// purgeDeletedUsers permanently removes, at every deletedUserPurgeInterval until ctx is cancelled, the accounts whose
+// deletion grace period has passed.
+func (h *handler) purgeDeletedUsers(ctx context.Context) {
+	ticker := time.NewTicker(deletedUserPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := h.users.PurgeDeleted(ctx, time.Now().Add(-h.config.AccountDeletionGracePeriod()))
+		switch {
+		case err != nil && !errors.Is(err, context.Canceled):
+			h.logger.Error("purging deleted users", zap.Error(err))
+		case purged > 0:
+			h.logger.Info("purged deleted users", zap.Int64("count", purged))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
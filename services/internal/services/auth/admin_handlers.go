@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+// userSortColumns maps the sort keys accepted by listUsers to the columns they order by.
+var userSortColumns = map[string]string{
+	"id":        "id",
+	"name":      "name",
+	"email":     "email",
+	"createdAt": "created_at",
+}
+
+func (h *handler) listUsers(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	filter := UserFilter{
+		Name:      readString(qs, "name", ""),
+		Email:     readString(qs, "email", ""),
+		Activated: readBool(qs, "activated", v),
+		Deleted:   readBool(qs, "deleted", v),
+	}
+
+	filters := Filters{
+		Page:        readInt(qs, "page", 1, v),
+		PageSize:    readInt(qs, "pageSize", 20, v),
+		Sort:        readString(qs, "sort", "id"),
+		SortColumns: userSortColumns,
+	}
+
+	if ValidateFilters(v, filters); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := h.users.GetAll(r.Context(), filter, filters)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.encode(w, r, http.StatusOK, envelope{"users": users, "metadata": metadata})
+}
+
+func (h *handler) showUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	h.encodeUser(w, r, http.StatusOK, user)
+}
+
+// updateUserByAdmin changes the name or email address of a user. Omitted fields are left as they are.
+func (h *handler) updateUserByAdmin(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.checkUserPrecondition(w, r, user) {
+		return
+	}
+
+	var input struct {
+		Name  *string `json:"name"`
+		Email *string `json:"email"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	if input.Email != nil {
+		user.Email = *input.Email
+	}
+
+	v := validator.New()
+	if ValidateUser(v, user); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !h.updateUser(w, r, user) {
+		return
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionUserUpdate, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	h.encodeUser(w, r, http.StatusOK, user)
+}
+
+// deactivateUser blocks the user from logging in and ends every session and grant they hold.
+func (h *handler) deactivateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.checkUserPrecondition(w, r, user) {
+		return
+	}
+
+	user.Activated = false
+
+	if !h.updateUser(w, r, user) {
+		return
+	}
+
+	if err := h.tokens.DeleteAllScopesForUser(r.Context(), user.ID); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionUserDeactivate, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	h.encodeUser(w, r, http.StatusOK, user)
+}
+
+// reactivateUser lets a deactivated user log in again. It also activates an account whose owner never confirmed
+// their email address, so any activation tokens still outstanding are discarded.
+func (h *handler) reactivateUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.checkUserPrecondition(w, r, user) {
+		return
+	}
+
+	user.Activated = true
+
+	if !h.updateUser(w, r, user) {
+		return
+	}
+
+	if err := h.tokens.DeleteAllForUser(r.Context(), ScopeActivation, user.ID); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionUserReactivate, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	h.encodeUser(w, r, http.StatusOK, user)
+}
+
+// restoreUser undoes the deletion of an account still within its deletion grace period. The credentials revoked when
+// it was deleted stay revoked, so the user has to log in again.
+func (h *handler) restoreUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.checkUserPrecondition(w, r, user) {
+		return
+	}
+
+	if user.DeletedAt == nil {
+		h.errorResponse(w, r, http.StatusConflict, "the account has not been deleted")
+		return
+	}
+
+	user.DeletedAt = nil
+
+	if !h.updateUser(w, r, user) {
+		return
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionUserRestore, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	h.encodeUser(w, r, http.StatusOK, user)
+}
+
+// forcePasswordReset replaces the user's password with a random one nobody knows, ends their sessions and emails
+// them a password reset token, for when their credentials are believed to be compromised.
+func (h *handler) forcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.checkUserPrecondition(w, r, user) {
+		return
+	}
+
+	// 32 random bytes encode to 43 characters, which every supported algorithm can hash, so there is nothing to
+	// validate before calling Set.
+	password, err := randomString(32)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := user.Password.Set(h.hasher, password); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !h.updateUser(w, r, user) {
+		return
+	}
+
+	if err := h.tokens.DeleteAllScopesForUser(r.Context(), user.ID); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := h.tokens.New(r.Context(), user.ID, passwordResetTokenTTL, ScopePasswordReset)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.sendEmail(user.Email, "password_reset.tmpl", map[string]any{
+		"Name":               user.Name,
+		"ResetPath":          h.path + "/users/password",
+		"PasswordResetToken": token.Plaintext,
+	})
+
+	h.audit(r, &AuditEvent{Action: AuditActionPasswordResetForce, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	message := "the user's password has been reset and a password reset email will be sent to them"
+	h.encode(w, r, http.StatusAccepted, envelope{"message": message})
+}
+
+// deleteUser removes the user. Their tokens, permissions and every other record referencing them are removed along
+// with them by the database's cascading foreign keys.
+func (h *handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.checkUserPrecondition(w, r, user) {
+		return
+	}
+
+	err := h.users.Delete(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.notFoundResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Failed logins are counted by email address, which a new account could take over.
+	if err := h.resetFailedLogins(r, user.Email); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionUserDelete, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	h.encode(w, r, http.StatusOK, envelope{"message": "user successfully deleted"})
+}
+
+// updateUser writes the user, responding with 409 if they were modified since being read or their email address is
+// taken. It reports whether the update succeeded.
+func (h *handler) updateUser(w http.ResponseWriter, r *http.Request, user *User) bool {
+	err := h.users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrDuplicateEmail):
+			h.conflictResponse(w, r, map[string]string{"email": "a user with this email address already exists"})
+		case errors.Is(err, ErrEditConflict):
+			h.editConflictResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return false
+	}
+
+	return true
+}
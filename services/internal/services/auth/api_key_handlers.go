@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/badrchoubai/services/internal/middleware"
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+func (h *handler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	var input struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+
+	key := &APIKey{
+		UserID:      user.ID,
+		Name:        input.Name,
+		Permissions: Permissions(nonNil(input.Permissions)),
+		Expiry:      input.Expiry,
+	}
+
+	held, err := h.permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if ValidateAPIKey(v, key, held); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := generateAPIKey(key); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if err := h.apiKeys.Insert(r.Context(), key); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{
+		Action:   AuditActionAPIKeyCreate,
+		TargetID: &user.ID,
+		Target:   key.Prefix,
+		Outcome:  AuditOutcomeSuccess,
+	})
+
+	// This is the only time the plaintext key is ever available.
+	h.encode(w, r, http.StatusCreated, envelope{"apiKey": key, "key": key.Plaintext})
+}
+
+func (h *handler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.apiKeys.GetAllForUser(r.Context(), middleware.ContextGetUser(r).ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.encode(w, r, http.StatusOK, envelope{"apiKeys": keys})
+}
+
+func (h *handler) deleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	id, err := readIDParam(r)
+	if err != nil {
+		h.notFoundResponse(w, r)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+
+	err = h.apiKeys.DeleteForUser(r.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.notFoundResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	h.audit(r, &AuditEvent{
+		Action:   AuditActionAPIKeyDelete,
+		TargetID: &user.ID,
+		Target:   strconv.FormatInt(id, 10),
+		Outcome:  AuditOutcomeSuccess,
+	})
+
+	h.encode(w, r, http.StatusOK, envelope{"message": "api key successfully deleted"})
+}
+
+// requireInteractiveUser writes a 403 and returns false if the request was authenticated with an API key. Keys must
+// not be able to mint or revoke other credentials, enroll MFA or see the user's sessions, or a leaked key could
+// outlive its own expiry and revocation or lock its owner out.
+func (h *handler) requireInteractiveUser(w http.ResponseWriter, r *http.Request) bool {
+	if middleware.ContextGetUser(r).IsAPIKey() {
+		h.errorResponse(w, r, http.StatusForbidden, "this action cannot be performed using an api key")
+		return false
+	}
+
+	return true
+}
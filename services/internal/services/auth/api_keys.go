@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"github.com/lib/pq"
+	"strings"
+	"time"
+
+	"github.com/badrchoubai/services/internal/middleware"
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const (
+	// apiKeyPrefix makes API keys recognizable, both to people and to secret scanners.
+	apiKeyPrefix = "ak_"
+
+	// apiKeyDisplayLength is the number of characters of a key, after its prefix, kept in plaintext so that a key can
+	// be identified in listings.
+	apiKeyDisplayLength = 8
+)
+
+// APIKey is a long-lived credential a user creates for non-interactive callers. Only the SHA-256 hash of the key is
+// stored; the plaintext is shown once, on creation.
+type APIKey struct {
+	ID          int64       `json:"id"`
+	UserID      int64       `json:"-"`
+	Name        string      `json:"name"`
+	Prefix      string      `json:"prefix"`
+	Plaintext   string      `json:"-"`
+	Hash        []byte      `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	Expiry      *time.Time  `json:"expiry"`
+	LastUsedAt  *time.Time  `json:"lastUsedAt"`
+}
+
+// generateAPIKey fills in a random plaintext key, its display prefix and its hash.
+func generateAPIKey(key *APIKey) error {
+	randomBytes := make([]byte, 20)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return err
+	}
+
+	secret := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes))
+
+	key.Plaintext = apiKeyPrefix + secret
+	key.Prefix = apiKeyPrefix + secret[:apiKeyDisplayLength]
+	key.Hash = hashToken(key.Plaintext)
+
+	return nil
+}
+
+// ValidateAPIKey checks a new key's name and expiry, and that it is granted only permissions the user holds.
+func ValidateAPIKey(v *validator.Validator, key *APIKey, held Permissions) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 200, "name", "must not be more than 200 bytes long")
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+
+	for _, code := range key.Permissions {
+		v.Check(held.Include(code), "permissions", "must contain only permissions you hold")
+	}
+}
+
+// APIKeyRepository provides access to the api_keys table.
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+// NewAPIKeyRepository returns an APIKeyRepository backed by the given database handle.
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// Insert stores a new API key, setting its ID and CreatedAt.
+func (r *APIKeyRepository) Insert(ctx context.Context, key *APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, hash, permissions, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`
+
+	args := []any{key.UserID, key.Name, key.Prefix, key.Hash, pq.Array([]string(key.Permissions)), key.Expiry}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAllForUser returns every API key belonging to the user, including expired ones, newest first.
+func (r *APIKeyRepository) GetAllForUser(ctx context.Context, userID int64) ([]*APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, permissions, created_at, expiry, last_used_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		var key APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array((*[]string)(&key.Permissions)),
+			&key.CreatedAt,
+			&key.Expiry,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// Authenticate returns the owner of the unexpired API key with the given plaintext, recording the time the key was
+// last used. The owner's permissions are limited to those the key was created with that they still hold, so revoking
+// a permission from a user also revokes it from their keys. ErrRecordNotFound is returned if there is no such key or
+// its owner has been deleted.
+func (r *APIKeyRepository) Authenticate(ctx context.Context, plaintext string) (*middleware.User, error) {
+	query := `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		FROM users
+		WHERE users.id = api_keys.user_id
+		AND api_keys.hash = $1
+		AND (api_keys.expiry IS NULL OR api_keys.expiry > $2)
+		AND users.deleted_at IS NULL
+		RETURNING api_keys.id, users.id, users.name, users.email, users.activated,
+			ARRAY(
+				SELECT permissions.code
+				FROM permissions
+				INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+				WHERE users_permissions.user_id = users.id
+				AND permissions.code = ANY(api_keys.permissions)
+			)`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var user middleware.User
+	err := r.db.QueryRowContext(ctx, query, hashToken(plaintext), time.Now()).Scan(
+		&user.APIKeyID,
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.Activated,
+		pq.Array(&user.Permissions),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// DeleteForUser removes the API key with the given ID if it belongs to the user, returning ErrRecordNotFound
+// otherwise.
+func (r *APIKeyRepository) DeleteForUser(ctx context.Context, id, userID int64) error {
+	query := `
+		DELETE FROM api_keys
+		WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
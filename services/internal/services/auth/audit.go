@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+
+	"github.com/badrchoubai/services/internal/config"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditActionAccountDelete        = "account-delete"
+	AuditActionAccountLockout       = "account-lockout"
+	AuditActionAccountUnlock        = "account-unlock"
+	AuditActionAPIKeyCreate         = "api-key-create"
+	AuditActionAPIKeyDelete         = "api-key-delete"
+	AuditActionEmailChange          = "email-change"
+	AuditActionLogin                = "login"
+	AuditActionLogout               = "logout"
+	AuditActionMFAEnroll            = "mfa-enroll"
+	AuditActionPasswordReset        = "password-reset"
+	AuditActionPasswordResetForce   = "password-reset-force"
+	AuditActionPasswordResetRequest = "password-reset-request"
+	AuditActionPermissionGrant      = "permission-grant"
+	AuditActionPermissionRevoke     = "permission-revoke"
+	AuditActionUserDeactivate       = "user-deactivate"
+	AuditActionUserDelete           = "user-delete"
+	AuditActionUserReactivate       = "user-reactivate"
+	AuditActionUserRestore          = "user-restore"
+	AuditActionUserUpdate           = "user-update"
+)
+
+// auditActions lists every action that may appear in the audit log.
+var auditActions = []string{
+	AuditActionAccountDelete,
+	AuditActionAccountLockout,
+	AuditActionAccountUnlock,
+	AuditActionAPIKeyCreate,
+	AuditActionAPIKeyDelete,
+	AuditActionEmailChange,
+	AuditActionLogin,
+	AuditActionLogout,
+	AuditActionMFAEnroll,
+	AuditActionPasswordReset,
+	AuditActionPasswordResetForce,
+	AuditActionPasswordResetRequest,
+	AuditActionPermissionGrant,
+	AuditActionPermissionRevoke,
+	AuditActionUserDeactivate,
+	AuditActionUserDelete,
+	AuditActionUserReactivate,
+	AuditActionUserRestore,
+	AuditActionUserUpdate,
+}
+
+// Outcomes of an audited action.
+const (
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeSuccess = "success"
+)
+
+// AuditEvent records a security-relevant action. ActorID is the user who performed it, or nil when nobody had
+// authenticated, and TargetID the user it was performed on, if any. Target describes anything else acted on, such as
+// the email address a failed login tried or the permission codes granted.
+type AuditEvent struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	ActorID   *int64    `json:"actorId"`
+	Action    string    `json:"action"`
+	TargetID  *int64    `json:"targetId"`
+	Target    string    `json:"target,omitempty"`
+	Outcome   string    `json:"outcome"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+}
+
+// AuditEventFilter narrows a listing of audit events. UserID matches events the user performed or was the target of;
+// zero values match every event. From is inclusive and To exclusive.
+type AuditEventFilter struct {
+	UserID int64
+	Action string
+	From   *time.Time
+	To     *time.Time
+}
+
+// AuditEventRepository provides access to the audit_events table.
+type AuditEventRepository struct {
+	db *sql.DB
+}
+
+// NewAuditEventRepository returns an AuditEventRepository backed by the given database handle.
+func NewAuditEventRepository(db *sql.DB) *AuditEventRepository {
+	return &AuditEventRepository{db: db}
+}
+
+// InsertBatch writes the events in a single transaction, so that either all of them are recorded or none are.
+func (r *AuditEventRepository) InsertBatch(ctx context.Context, events []*AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (created_at, actor_id, action, target_id, target, outcome, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		_, err := stmt.ExecContext(
+			ctx,
+			event.CreatedAt,
+			event.ActorID,
+			event.Action,
+			event.TargetID,
+			event.Target,
+			event.Outcome,
+			event.IP,
+			event.UserAgent,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetAll returns up to limit events matching the filter, newest first. When after is non-zero only events older than
+// the event with that ID are returned, so that the ID of the last event of one page is the cursor for the next.
+func (r *AuditEventRepository) GetAll(
+	ctx context.Context,
+	filter AuditEventFilter,
+	after int64,
+	limit int,
+) ([]*AuditEvent, error) {
+	query := `
+		SELECT id, created_at, actor_id, action, target_id, target, outcome, ip, user_agent
+		FROM audit_events
+		WHERE ($1::bigint = 0 OR actor_id = $1 OR target_id = $1)
+		AND ($2 = '' OR action = $2)
+		AND ($3::timestamptz IS NULL OR created_at >= $3)
+		AND ($4::timestamptz IS NULL OR created_at < $4)
+		AND ($5::bigint = 0 OR id < $5)
+		ORDER BY id DESC
+		LIMIT $6`
+
+	args := []any{filter.UserID, filter.Action, filter.From, filter.To, after, limit}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// ForEachForUser calls fn with every event the user performed or was the target of, oldest first, stopping at the
+// first error fn returns. Events are read one at a time rather than loaded together, so ctx rather than queryTimeout
+// bounds how long the iteration may take.
+func (r *AuditEventRepository) ForEachForUser(ctx context.Context, userID int64, fn func(*AuditEvent) error) error {
+	query := `
+		SELECT id, created_at, actor_id, action, target_id, target, outcome, ip, user_agent
+		FROM audit_events
+		WHERE actor_id = $1 OR target_id = $1
+		ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func scanAuditEvent(rows *sql.Rows) (*AuditEvent, error) {
+	var event AuditEvent
+
+	err := rows.Scan(
+		&event.ID,
+		&event.CreatedAt,
+		&event.ActorID,
+		&event.Action,
+		&event.TargetID,
+		&event.Target,
+		&event.Outcome,
+		&event.IP,
+		&event.UserAgent,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// Auditor writes audit events to the database in the background, batching them so that recording an event never
+// waits on the database. Events are written once a batch is full or has waited for the flush interval.
+type Auditor struct {
+	events        chan *AuditEvent
+	logger        *zap.Logger
+	repo          *AuditEventRepository
+	batchSize     int
+	flushInterval time.Duration
+
+	// mu guards stopped, which is set once Run has started draining the queue. From then on events are written
+	// synchronously, so that those recorded by requests still completing during shutdown are not lost.
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// NewAuditor returns an Auditor writing to repo. Run must be called for queued events to be written.
+func NewAuditor(cfg config.Config, repo *AuditEventRepository, logger *zap.Logger) *Auditor {
+	flushInterval := cfg.AuditFlushInterval()
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+
+	return &Auditor{
+		events:        make(chan *AuditEvent, max(cfg.AuditQueueSize(), 1)),
+		logger:        logger,
+		repo:          repo,
+		batchSize:     max(cfg.AuditBatchSize(), 1),
+		flushInterval: flushInterval,
+	}
+}
+
+// Record queues the event to be written. It never blocks: when the queue is full the event is logged and dropped.
+func (a *Auditor) Record(event *AuditEvent) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.stopped {
+		a.write([]*AuditEvent{event})
+		return
+	}
+
+	select {
+	case a.events <- event:
+	default:
+		a.logger.Warn("audit queue full, dropping event", zap.Any("event", event))
+	}
+}
+
+// Run writes queued events until ctx is cancelled, then writes whatever is still queued and returns.
+func (a *Auditor) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*AuditEvent, 0, a.batchSize)
+
+	flush := func() {
+		if len(batch) > 0 {
+			a.write(batch)
+			batch = batch[:0]
+		}
+	}
+
+	for {
+		select {
+		case event := <-a.events:
+			batch = append(batch, event)
+			if len(batch) >= a.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			// Once stopped is set no further events can be queued, so the queue can be drained completely.
+			a.mu.Lock()
+			a.stopped = true
+			a.mu.Unlock()
+
+			for {
+				select {
+				case event := <-a.events:
+					batch = append(batch, event)
+					if len(batch) >= a.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// write inserts the events, logging them if they cannot be stored so that they are not lost altogether. It does not
+// use the context Run was given, which is cancelled by the time the last events are written.
+func (a *Auditor) write(events []*AuditEvent) {
+	if err := a.repo.InsertBatch(context.Background(), events); err != nil {
+		a.logger.Error("writing audit events", zap.Error(err), zap.Any("events", events))
+	}
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"github.com/tomasen/realip"
+	"net/http"
+	"time"
+
+	"github.com/badrchoubai/services/internal/middleware"
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+// audit records an action taken through r, filling in when it happened and the caller's IP address and user agent.
+// Unless the event names one, its actor is the authenticated user making the request.
+func (h *handler) audit(r *http.Request, event *AuditEvent) {
+	if event.ActorID == nil {
+		if user := middleware.ContextGetUser(r); !user.IsAnonymous() {
+			event.ActorID = &user.ID
+		}
+	}
+
+	event.CreatedAt = time.Now()
+	event.IP = realip.FromRequest(r)
+	event.UserAgent = r.UserAgent()
+
+	h.auditor.Record(event)
+}
+
+// auditLogin records that the user logged in. The request carries no credentials yet, so the user is named as actor.
+func (h *handler) auditLogin(r *http.Request, user *User) {
+	h.audit(r, &AuditEvent{
+		Action:   AuditActionLogin,
+		ActorID:  &user.ID,
+		TargetID: &user.ID,
+		Target:   user.Email,
+		Outcome:  AuditOutcomeSuccess,
+	})
+}
+
+// listAuditEvents returns a page of the audit log, newest first. Pages are fetched by cursor rather than number, so
+// that events recorded while paging do not shift later pages.
+func (h *handler) listAuditEvents(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	filter := AuditEventFilter{
+		UserID: int64(readInt(qs, "userId", 0, v)),
+		Action: readString(qs, "action", ""),
+		From:   readTime(qs, "from", v),
+		To:     readTime(qs, "to", v),
+	}
+
+	cursor := int64(readInt(qs, "cursor", 0, v))
+	pageSize := readInt(qs, "pageSize", 20, v)
+
+	v.Check(filter.UserID >= 0, "userId", "must not be negative")
+	v.Check(filter.Action == "" || validator.PermittedValue(filter.Action, auditActions...), "action", "is not known")
+	v.Check(filter.From == nil || filter.To == nil || filter.From.Before(*filter.To), "to", "must be after from")
+	v.Check(cursor >= 0, "cursor", "must not be negative")
+	v.Check(pageSize > 0, "pageSize", "must be greater than zero")
+	v.Check(pageSize <= maxPageSize, "pageSize", "must be a maximum of 100")
+
+	if !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// One event more than the page holds is fetched to learn whether there is a next page.
+	events, err := h.auditEvents.GetAll(r.Context(), filter, cursor, pageSize+1)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	metadata := CursorMetadata{PageSize: pageSize}
+
+	if len(events) > pageSize {
+		events = events[:pageSize]
+		metadata.NextCursor = events[pageSize-1].ID
+	}
+
+	h.encode(w, r, http.StatusOK, envelope{"auditEvents": events, "metadata": metadata})
+}
@@ -5,15 +5,25 @@ package auth
 
 import (
 	"context"
+	"fmt"
 	"go.uber.org/zap"
 
 	"github.com/badrchoubai/services/internal/config"
 	"github.com/badrchoubai/services/internal/database"
+	"github.com/badrchoubai/services/internal/jwt"
+	"github.com/badrchoubai/services/internal/mailer"
+	"github.com/badrchoubai/services/internal/middleware"
+	"github.com/badrchoubai/services/internal/passwords"
 	"github.com/badrchoubai/services/internal/service"
 )
 
 // NewAuthService creates a new service for handling Authentication and Authorization
 func NewAuthService(ctx context.Context, cfg *config.AppConfig, logger *zap.Logger) (*service.Service, error) {
+	m, err := mailer.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := database.NewDatabase(ctx, cfg)
 	if err != nil {
 		logger.Error(
@@ -24,18 +34,81 @@ func NewAuthService(ctx context.Context, cfg *config.AppConfig, logger *zap.Logg
 		return nil, err
 	}
 
+	return newAuthService(ctx, cfg, logger, db, m)
+}
+
+// newAuthService creates the service on an established database connection, sending email through m.
+func newAuthService(
+	ctx context.Context,
+	cfg *config.AppConfig,
+	logger *zap.Logger,
+	db *database.Database,
+	m mailer.Mailer,
+) (*service.Service, error) {
+	keys, err := loadSigningKeys(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := passwords.NewPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher, err := passwords.NewHasher(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticators := []middleware.Authenticator{
+		NewTokenAuthenticator(db.DB()),
+		NewOAuthAuthenticator(db.DB()),
+		NewAPIKeyAuthenticator(db.DB()),
+	}
+
+	switch cfg.AccessTokenFormat() {
+	case accessTokenFormatOpaque:
+	case accessTokenFormatJWT:
+		authenticators = append(
+			authenticators,
+			middleware.NewJWTAuthenticator(keys, cfg.JWTIssuer(), cfg.JWTAudience()),
+		)
+	default:
+		return nil, fmt.Errorf("unknown access token format %q", cfg.AccessTokenFormat())
+	}
+
 	svc, err := service.NewService(
 		ctx,
 		"auth-v1",
 		service.WithLogger(logger),
 		service.WithDatabase(db),
+		service.WithMiddleware(
+			middleware.Authenticate(logger, authenticators...),
+		),
 	)
 
 	if svc != nil {
-		addRoutes(svc)
+		h := newHandler(svc, cfg, m, keys, policy, hasher)
+		addRoutes(svc, h)
+
+		svc.Background(func() { h.auditor.Run(ctx) })
+
+		if cfg.AccountDeletionGracePeriod() > 0 {
+			svc.Background(func() { h.purgeDeletedUsers(ctx) })
+		}
 
 		return svc, nil
 	}
 
 	return nil, err
 }
+
+// loadSigningKeys loads the configured JWT signing keys, falling back to an ephemeral key when none are configured.
+func loadSigningKeys(cfg *config.AppConfig, logger *zap.Logger) (*jwt.KeySet, error) {
+	if len(cfg.JWTKeyFiles()) == 0 {
+		logger.Warn("no JWT signing keys configured, generating an ephemeral key")
+		return jwt.GenerateKeySet()
+	}
+
+	return jwt.LoadKeySet(cfg.JWTKeyFiles()...)
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/badrchoubai/services/internal/middleware"
+)
+
+type tokenAuthenticator struct {
+	tokens *TokenRepository
+	scope  string
+}
+
+// NewTokenAuthenticator returns a middleware.Authenticator for the opaque access tokens issued on login.
+func NewTokenAuthenticator(db *sql.DB) middleware.Authenticator {
+	return &tokenAuthenticator{tokens: NewTokenRepository(db), scope: ScopeAuthentication}
+}
+
+// NewOAuthAuthenticator returns a middleware.Authenticator for opaque access tokens issued to OAuth2 clients on behalf
+// of a user. The resulting User carries the client and granted scopes but no permissions, so it only passes
+// RequireScope.
+func NewOAuthAuthenticator(db *sql.DB) middleware.Authenticator {
+	return &tokenAuthenticator{tokens: NewTokenRepository(db), scope: ScopeOAuthAccess}
+}
+
+// Authenticate returns the caller the token was issued to. Anything that cannot be a token is rejected without a
+// query.
+func (a *tokenAuthenticator) Authenticate(ctx context.Context, token string) (*middleware.User, error) {
+	if len(token) != tokenPlaintextLength {
+		return nil, middleware.ErrInvalidToken
+	}
+
+	user, err := a.tokens.Authenticate(ctx, a.scope, token)
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			return nil, middleware.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+type apiKeyAuthenticator struct {
+	apiKeys *APIKeyRepository
+}
+
+// NewAPIKeyAuthenticator returns a middleware.Authenticator for API keys, which may be presented either in the
+// X-API-Key header or as a bearer token.
+func NewAPIKeyAuthenticator(db *sql.DB) middleware.Authenticator {
+	return &apiKeyAuthenticator{apiKeys: NewAPIKeyRepository(db)}
+}
+
+// Authenticate returns the owner of the key. Anything without the API key prefix is rejected without a query.
+func (a *apiKeyAuthenticator) Authenticate(ctx context.Context, key string) (*middleware.User, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, middleware.ErrInvalidToken
+	}
+
+	user, err := a.apiKeys.Authenticate(ctx, key)
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			return nil, middleware.ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"html/template"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// authorizePage is the data the login and consent page is rendered with.
+type authorizePage struct {
+	ServiceName string
+	ClientName  string
+	Scopes      []string
+	Params      url.Values
+	Email       string
+	Error       string
+}
+
+// authorize implements the authorization endpoint for the authorization code grant. It shows a page on which the user
+// logs in and approves the client's access, which posts back to approveAuthorization. The service keeps no browser
+// sessions, so the user logs in every time, and requests with prompt=none, which forbid showing the page, are refused
+// with login_required.
+func (h *handler) authorize(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	query := r.URL.Query()
+
+	req, ok := h.parseAuthorizationRequest(w, r, query)
+	if !ok {
+		return
+	}
+
+	if slices.Contains(strings.Fields(query.Get("prompt")), "none") {
+		h.authorizationErrorRedirect(w, r, req, "login_required", "the user must log in")
+		return
+	}
+
+	h.renderAuthorizePage(w, r, http.StatusOK, req, "", "")
+}
+
+// approveAuthorization handles the login and consent form. The password, and the second factor of users who have
+// enrolled one, are checked with the same throttling and lockout as any other login before a code is issued. Denying
+// the request returns access_denied to the client without checking anything.
+func (h *handler) approveAuthorization(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	req, ok := h.parseAuthorizationRequest(w, r, r.PostForm)
+	if !ok {
+		return
+	}
+
+	if r.PostForm.Get("decision") != "allow" {
+		h.authorizationErrorRedirect(w, r, req, "access_denied", "the user denied the request")
+		return
+	}
+
+	email := r.PostForm.Get("email")
+	password := r.PostForm.Get("password")
+	code := r.PostForm.Get("code")
+
+	invalidCredentials := func() {
+		h.renderAuthorizePage(w, r, http.StatusUnauthorized, req, email, "invalid email address, password or code")
+	}
+
+	v := validator.New()
+	ValidateEmail(v, email)
+	ValidatePasswordPlaintext(v, password)
+
+	if !v.Valid() {
+		invalidCredentials()
+		return
+	}
+
+	retryAfter, err := h.loginRetryAfter(r, email)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		message := "too many failed login attempts, please try again later"
+		h.renderAuthorizePage(w, r, http.StatusTooManyRequests, req, email, message)
+		return
+	}
+
+	user, err := h.users.GetByEmail(r.Context(), email)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			if err := h.hasher.VerifyDummy(password); err != nil {
+				h.serverErrorResponse(w, r, err)
+				return
+			}
+			if err := h.recordFailedLogin(r, email, nil); err != nil {
+				h.serverErrorResponse(w, r, err)
+				return
+			}
+			invalidCredentials()
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	match, rehash, err := user.Password.Matches(h.hasher, password)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		if err := h.recordFailedLogin(r, email, user); err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+		invalidCredentials()
+		return
+	}
+
+	if rehash {
+		h.rehashPassword(r, user, password)
+	}
+
+	if !user.Activated {
+		h.renderAuthorizePage(w, r, http.StatusForbidden, req, email, "your user account must be activated to log in")
+		return
+	}
+
+	mfaRequired, err := h.mfaRequired(r, user.ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if mfaRequired {
+		if code == "" {
+			message := "enter the code from your authenticator app, or a recovery code"
+			h.renderAuthorizePage(w, r, http.StatusUnauthorized, req, email, message)
+			return
+		}
+
+		// The one field takes either kind of code, telling them apart by format.
+		var ok bool
+		if validator.Matches(code, totpCodeRX) {
+			ok, err = h.verifySecondFactor(r, user.ID, code, "")
+		} else {
+			ok, err = h.verifySecondFactor(r, user.ID, "", code)
+		}
+		if err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+
+		if !ok {
+			if err := h.recordFailedLogin(r, email, user); err != nil {
+				h.serverErrorResponse(w, r, err)
+				return
+			}
+			invalidCredentials()
+			return
+		}
+	}
+
+	if err := h.resetFailedLogins(r, user.Email); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.auditLogin(r, user)
+
+	h.grantAuthorization(w, r, req, user)
+}
+
+// renderAuthorizePage writes the login and consent page for the request, with message explaining why a previous
+// submission failed. The page forbids framing, so that another site cannot trick the user into approving a client.
+func (h *handler) renderAuthorizePage(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	req *authorizationRequest,
+	email, message string,
+) {
+	tmpl, err := template.ParseFS(templateFS, "templates/authorize.tmpl")
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	page := authorizePage{
+		ServiceName: h.name,
+		ClientName:  req.client.Name,
+		Scopes:      req.scopes,
+		Params:      req.params,
+		Email:       email,
+		Error:       message,
+	}
+
+	// Render into a buffer first, so that a template error can still be reported as such.
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, page); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+
+	if _, err := buf.WriteTo(w); err != nil {
+		h.logError(r, err)
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+func (h *handler) registerClient(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirectUris"`
+		GrantTypes   []string `json:"grantTypes"`
+		Scopes       []string `json:"scopes"`
+		Public       bool     `json:"public"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	id, secret, err := generateClientCredentials()
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	client := &Client{
+		ID:           id,
+		Name:         input.Name,
+		RedirectURIs: nonNil(input.RedirectURIs),
+		GrantTypes:   nonNil(input.GrantTypes),
+		Scopes:       nonNil(input.Scopes),
+	}
+
+	if !input.Public {
+		client.SecretHash = hashToken(secret)
+	}
+
+	v := validator.New()
+	if ValidateClient(v, client); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if err := h.clients.Insert(r.Context(), client); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The secret is only ever shown here; like tokens, only its hash is stored.
+	data := envelope{"client": client}
+	if !input.Public {
+		data["clientSecret"] = secret
+	}
+
+	h.encode(w, r, http.StatusCreated, data)
+}
+
+func (h *handler) deleteClient(w http.ResponseWriter, r *http.Request) {
+	err := h.clients.Delete(r.Context(), r.PathValue("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.notFoundResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	h.encode(w, r, http.StatusOK, envelope{"message": "client successfully deleted"})
+}
+
+// nonNil returns s, or an empty slice if s is nil, so that it is stored and encoded as an empty array.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/lib/pq"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const (
+	// GrantAuthorizationCode is the OAuth2 authorization code grant, which requires PKCE.
+	GrantAuthorizationCode = "authorization_code"
+
+	// GrantClientCredentials is the OAuth2 grant in which a confidential client acts on its own behalf.
+	GrantClientCredentials = "client_credentials"
+
+	// GrantRefreshToken is the OAuth2 grant exchanging a refresh token for a new access token.
+	GrantRefreshToken = "refresh_token"
+)
+
+// Client is an application registered to obtain tokens from the OAuth2 endpoints. Public clients, such as single page
+// and native apps, cannot keep a secret and have no SecretHash.
+type Client struct {
+	ID           string    `json:"clientId"`
+	SecretHash   []byte    `json:"-"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirectUris"`
+	GrantTypes   []string  `json:"grantTypes"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Public reports whether the client was registered without a secret.
+func (c *Client) Public() bool {
+	return c.SecretHash == nil
+}
+
+// SecretMatches reports whether secret is the client's secret. It always reports false for public clients.
+func (c *Client) SecretMatches(secret string) bool {
+	if c.Public() {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hashToken(secret), c.SecretHash) == 1
+}
+
+// AllowsGrant reports whether the client was registered for the grant type.
+func (c *Client) AllowsGrant(grantType string) bool {
+	return slices.Contains(c.GrantTypes, grantType)
+}
+
+// AllowsRedirectURI reports whether uri exactly matches one of the client's registered redirect URIs.
+func (c *Client) AllowsRedirectURI(uri string) bool {
+	return slices.Contains(c.RedirectURIs, uri)
+}
+
+// generateClientCredentials returns a random client ID and secret.
+func generateClientCredentials() (string, string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	return hex.EncodeToString(id), base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// ValidateClient checks a client registration. Public clients can only use the authorization code and refresh
+// grants, and every client using the authorization code grant needs at least one redirect URI.
+func ValidateClient(v *validator.Validator, client *Client) {
+	v.Check(client.Name != "", "name", "must be provided")
+	v.Check(len(client.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	v.Check(len(client.GrantTypes) > 0, "grantTypes", "must contain at least one entry")
+	for _, grantType := range client.GrantTypes {
+		v.Check(
+			validator.PermittedValue(grantType, GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken),
+			"grantTypes",
+			"must contain only authorization_code, client_credentials or refresh_token",
+		)
+	}
+
+	if client.Public() {
+		v.Check(!client.AllowsGrant(GrantClientCredentials), "grantTypes", "client_credentials requires a secret")
+	}
+
+	if client.AllowsGrant(GrantAuthorizationCode) {
+		v.Check(len(client.RedirectURIs) > 0, "redirectUris", "must contain at least one entry")
+	}
+
+	for _, uri := range client.RedirectURIs {
+		v.Check(validRedirectURI(uri), "redirectUris", "must contain only absolute URIs without a fragment")
+	}
+
+	for _, scope := range client.Scopes {
+		v.Check(validator.Matches(scope, scopeTokenRX), "scopes", "must contain only valid scope tokens")
+	}
+}
+
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+
+	return u.IsAbs() && u.Host != "" && u.Fragment == ""
+}
+
+// ClientRepository provides access to the clients table.
+type ClientRepository struct {
+	db *sql.DB
+}
+
+// NewClientRepository returns a ClientRepository backed by the given database handle.
+func NewClientRepository(db *sql.DB) *ClientRepository {
+	return &ClientRepository{db: db}
+}
+
+// Insert stores a new client, setting its CreatedAt.
+func (r *ClientRepository) Insert(ctx context.Context, client *Client) error {
+	query := `
+		INSERT INTO clients (id, secret_hash, name, redirect_uris, grant_types, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at`
+
+	args := []any{
+		client.ID,
+		nullBytes(client.SecretHash),
+		client.Name,
+		pq.Array(client.RedirectURIs),
+		pq.Array(client.GrantTypes),
+		pq.Array(client.Scopes),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, query, args...).Scan(&client.CreatedAt)
+}
+
+// Get returns the client with the given ID.
+func (r *ClientRepository) Get(ctx context.Context, id string) (*Client, error) {
+	query := `
+		SELECT id, secret_hash, name, redirect_uris, grant_types, scopes, created_at
+		FROM clients
+		WHERE id = $1`
+
+	var client Client
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&client.ID,
+		&client.SecretHash,
+		&client.Name,
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.GrantTypes),
+		pq.Array(&client.Scopes),
+		&client.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+// Delete removes the client with the given ID, along with every code and token issued to it.
+func (r *ClientRepository) Delete(ctx context.Context, id string) error {
+	query := `
+		DELETE FROM clients
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"errors"
+	"github.com/tomasen/realip"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/badrchoubai/services/internal/middleware"
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const emailChangeTokenTTL = 24 * time.Hour
+
+// requestEmailChange records the address the user wants to change to and sends a confirmation token to it. The old
+// address is told about the request, so that the owner notices if someone else holding a session asked for it.
+func (h *handler) requestEmailChange(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	ValidateEmail(v, input.Email)
+	ValidatePasswordPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := h.users.Get(r.Context(), middleware.ContextGetUser(r).ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !h.confirmPassword(w, r, user, input.Password) {
+		return
+	}
+
+	if strings.EqualFold(input.Email, user.Email) {
+		v.AddError("email", "must be different from your current email address")
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = h.users.GetByEmail(r.Context(), input.Email)
+	switch {
+	case err == nil:
+		h.conflictResponse(w, r, map[string]string{"email": "a user with this email address already exists"})
+		return
+	case !errors.Is(err, ErrRecordNotFound):
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user.PendingEmail = &input.Email
+
+	err = h.users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEditConflict):
+			h.editConflictResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Only the most recently requested address can be confirmed.
+	if err := h.tokens.DeleteAllForUser(r.Context(), ScopeEmailChange, user.ID); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := h.tokens.New(r.Context(), user.ID, emailChangeTokenTTL, ScopeEmailChange)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.sendEmail(input.Email, "email_change.tmpl", map[string]any{
+		"Name":             user.Name,
+		"ConfirmationPath": h.path + "/users/email",
+		"EmailChangeToken": token.Plaintext,
+	})
+
+	h.sendEmail(user.Email, "security_notice.tmpl", map[string]any{
+		"Name":  user.Name,
+		"Event": "A change of your account's email address to " + input.Email + " was requested.",
+		"Time":  time.Now().UTC().Format(time.RFC1123),
+		"IP":    realip.FromRequest(r),
+	})
+
+	message := "a confirmation email will be sent to the new address within a few minutes"
+	h.encode(w, r, http.StatusAccepted, envelope{"message": message})
+}
+
+// confirmEmailChange replaces the user's email address with the pending one once they have shown they own it by
+// presenting the token sent there.
+func (h *handler) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := h.users.GetForToken(r.Context(), ScopeEmailChange, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			v.AddError("token", "invalid or expired email change token")
+			h.failedValidationResponse(w, r, v.Errors)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.PendingEmail == nil {
+		v.AddError("token", "invalid or expired email change token")
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user.Email = *user.PendingEmail
+	user.PendingEmail = nil
+
+	// The address may have been registered since the change was requested; the unique constraint on users.email is
+	// the only check that cannot race.
+	err = h.users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrDuplicateEmail):
+			h.conflictResponse(w, r, map[string]string{"email": "a user with this email address already exists"})
+		case errors.Is(err, ErrEditConflict):
+			h.editConflictResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Password reset tokens were sent to the old address, which no longer controls the account.
+	for _, scope := range []string{ScopeEmailChange, ScopePasswordReset} {
+		if err := h.tokens.DeleteAllForUser(r.Context(), scope, user.ID); err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	h.audit(r, &AuditEvent{
+		Action:   AuditActionEmailChange,
+		ActorID:  &user.ID,
+		TargetID: &user.ID,
+		Target:   user.Email,
+		Outcome:  AuditOutcomeSuccess,
+	})
+
+	h.encode(w, r, http.StatusOK, envelope{"user": user})
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type errorResponse struct {
+	Error any `json:"error"`
+}
+
+func (h *handler) logError(r *http.Request, err error) {
+	h.logger.Error(
+		"handling request",
+		zap.String("method", r.Method),
+		zap.String("url", r.URL.String()),
+		zap.Error(err),
+	)
+}
+
+func (h *handler) errorResponse(w http.ResponseWriter, r *http.Request, status int, message any) {
+	if err := h.encoderDecoder.EncodeResponse(w, status, &errorResponse{Error: message}); err != nil {
+		h.logError(r, err)
+	}
+}
+
+func (h *handler) serverErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	h.logError(r, err)
+
+	message := "the server encountered a problem and could not process your request"
+	h.errorResponse(w, r, http.StatusInternalServerError, message)
+}
+
+func (h *handler) notFoundResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource could not be found"
+	h.errorResponse(w, r, http.StatusNotFound, message)
+}
+
+func (h *handler) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
+	h.errorResponse(w, r, http.StatusBadRequest, err.Error())
+}
+
+func (h *handler) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	h.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+}
+
+func (h *handler) conflictResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	h.errorResponse(w, r, http.StatusConflict, errors)
+}
+
+func (h *handler) editConflictResponse(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please try again"
+	h.errorResponse(w, r, http.StatusConflict, message)
+}
+
+func (h *handler) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been modified since you last fetched it, please fetch it again and retry"
+	h.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (h *handler) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	h.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (h *handler) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to log in"
+	h.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (h *handler) invalidRefreshTokenResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid, expired or previously used refresh token"
+	h.errorResponse(w, r, http.StatusUnauthorized, message)
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ETag returns the entity tag of the user's current representation. It is derived from the version, which every
+// update increments, so a client holding it can make its next update conditional with If-Match.
+func (u *User) ETag() string {
+	return `"` + strconv.Itoa(u.Version) + `"`
+}
+
+// ifMatch reports whether the request's If-Match header, if it has one, lists etag or "*". The comparison is strong,
+// as RFC 9110 requires for If-Match, so weak tags never match.
+func ifMatch(r *http.Request, etag string) bool {
+	values := r.Header.Values("If-Match")
+	if len(values) == 0 {
+		return true
+	}
+
+	for _, value := range values {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkUserPrecondition writes a 412 and returns false if the request is conditional on a version of the user other
+// than the one just read.
+func (h *handler) checkUserPrecondition(w http.ResponseWriter, r *http.Request, user *User) bool {
+	if !ifMatch(r, user.ETag()) {
+		h.preconditionFailedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// encodeUser responds with the user and their ETag.
+func (h *handler) encodeUser(w http.ResponseWriter, r *http.Request, status int, user *User) {
+	w.Header().Set("ETag", user.ETag())
+	h.encode(w, r, status, envelope{"user": user})
+}
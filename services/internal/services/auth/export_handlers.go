@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/badrchoubai/services/internal/middleware"
+)
+
+// exportWriteTimeout bounds how long streaming an export may take. It replaces the server's write timeout, which is
+// sized for ordinary responses rather than an archive of a user's whole history.
+const exportWriteTimeout = 5 * time.Minute
+
+// exportFile is a file of a personal data export. write streams its contents into the archive.
+type exportFile struct {
+	name  string
+	write func(ctx context.Context, w io.Writer) error
+}
+
+// exportJSON returns an exportFile write function encoding the value load returns as indented JSON.
+func exportJSON(load func(ctx context.Context) (any, error)) func(ctx context.Context, w io.Writer) error {
+	return func(ctx context.Context, w io.Writer) error {
+		v, err := load(ctx)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+
+		return enc.Encode(v)
+	}
+}
+
+// exportCurrentUser streams a zip archive of JSON files holding everything stored about the logged in user. Secrets
+// such as password and token hashes are never included. Each file is written to the client as soon as it is complete,
+// so the archive is never held in memory.
+func (h *handler) exportCurrentUser(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	// Load the user before anything is written, while an error can still be reported as such.
+	user, err := h.users.Get(r.Context(), middleware.ContextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.notFoundResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	files := []exportFile{
+		{"profile.json", exportJSON(func(ctx context.Context) (any, error) {
+			return user, nil
+		})},
+		{"permissions.json", exportJSON(func(ctx context.Context) (any, error) {
+			return h.permissions.GetAllForUser(ctx, user.ID)
+		})},
+		{"sessions.json", exportJSON(func(ctx context.Context) (any, error) {
+			return h.sessionsForUser(r, user.ID)
+		})},
+		{"api_keys.json", exportJSON(func(ctx context.Context) (any, error) {
+			return h.apiKeys.GetAllForUser(ctx, user.ID)
+		})},
+		{"identities.json", exportJSON(func(ctx context.Context) (any, error) {
+			return h.federation.GetIdentitiesForUser(ctx, user.ID)
+		})},
+		{"audit_events.json", func(ctx context.Context, w io.Writer) error {
+			return h.exportAuditEvents(ctx, w, user.ID)
+		}},
+	}
+
+	rc := http.NewResponseController(w)
+	err = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%d.zip"`, user.ID))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	// The status has been sent, so a failure from here on can only be logged. Abandoning the archive without writing
+	// its central directory leaves the client with a truncated zip it cannot mistake for a complete export.
+	zw := zip.NewWriter(w)
+
+	for _, file := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     file.name,
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			h.logger.Error("writing export", zap.Int64("user", user.ID), zap.Error(err))
+			return
+		}
+
+		if err := file.write(r.Context(), fw); err != nil {
+			h.logger.Error("writing export", zap.Int64("user", user.ID), zap.String("file", file.name), zap.Error(err))
+			return
+		}
+
+		// The zip writer buffers its output, so it has to be flushed before the response can be.
+		if err := zw.Flush(); err != nil {
+			h.logger.Error("writing export", zap.Int64("user", user.ID), zap.Error(err))
+			return
+		}
+
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			h.logger.Error("writing export", zap.Int64("user", user.ID), zap.Error(err))
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		h.logger.Error("writing export", zap.Int64("user", user.ID), zap.Error(err))
+	}
+}
+
+// exportAuditEvents writes the audit events concerning the user as a JSON array, encoding each event as it is read so
+// that a long history is never held in memory.
+func (h *handler) exportAuditEvents(ctx context.Context, w io.Writer, userID int64) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+
+	separator := "\n\t"
+
+	err := h.auditEvents.ForEachForUser(ctx, userID, func(event *AuditEvent) error {
+		js, err := json.MarshalIndent(event, "\t", "\t")
+		if err != nil {
+			return err
+		}
+
+		if _, err := io.WriteString(w, separator); err != nil {
+			return err
+		}
+		separator = ",\n\t"
+
+		_, err = w.Write(js)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n]\n")
+	return err
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/badrchoubai/services/internal/config"
+	"github.com/badrchoubai/services/internal/oidc"
+)
+
+// identityProviderTimeout bounds each request made to an upstream identity provider.
+const identityProviderTimeout = 10 * time.Second
+
+// Identity links a local user to their account at an upstream identity provider.
+type Identity struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	UserID    int64     `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FederatedLogin is a login in progress at an upstream identity provider. The state is handed to the provider and
+// comes back on the callback; the nonce and PKCE code verifier never leave the service.
+type FederatedLogin struct {
+	State        string
+	Hash         []byte
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	Expiry       time.Time
+}
+
+// newIdentityProviders builds a client for each configured upstream identity provider, keyed by name.
+func newIdentityProviders(cfg *config.AppConfig) map[string]*oidc.Provider {
+	client := &http.Client{Timeout: identityProviderTimeout}
+	providers := make(map[string]*oidc.Provider, len(cfg.IdentityProviders()))
+
+	for _, idp := range cfg.IdentityProviders() {
+		providers[idp.Name()] = oidc.NewProvider(oidc.Config{
+			Issuer:       idp.Issuer(),
+			ClientID:     idp.ClientID(),
+			ClientSecret: idp.ClientSecret(),
+			RedirectURL:  cfg.OIDCIssuer() + "/federation/" + idp.Name() + "/callback",
+			Scopes:       idp.Scopes(),
+		}, client)
+	}
+
+	return providers
+}
+
+// randomString returns n random bytes encoded as unpadded base64url.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// FederationRepository provides access to the user_identities and federated_logins tables.
+type FederationRepository struct {
+	db *sql.DB
+}
+
+// NewFederationRepository returns a FederationRepository backed by the given database handle.
+func NewFederationRepository(db *sql.DB) *FederationRepository {
+	return &FederationRepository{db: db}
+}
+
+// GetIdentity returns the identity with the given subject at the provider.
+func (r *FederationRepository) GetIdentity(ctx context.Context, provider, subject string) (*Identity, error) {
+	query := `
+		SELECT provider, subject, user_id, email, created_at
+		FROM user_identities
+		WHERE provider = $1 AND subject = $2`
+
+	var identity Identity
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.Provider,
+		&identity.Subject,
+		&identity.UserID,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &identity, nil
+}
+
+// GetIdentitiesForUser returns every upstream identity linked to the user, oldest first.
+func (r *FederationRepository) GetIdentitiesForUser(ctx context.Context, userID int64) ([]*Identity, error) {
+	query := `
+		SELECT provider, subject, user_id, email, created_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at, provider`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*Identity{}
+
+	for rows.Next() {
+		var identity Identity
+
+		err := rows.Scan(
+			&identity.Provider,
+			&identity.Subject,
+			&identity.UserID,
+			&identity.Email,
+			&identity.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, &identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// InsertIdentity links an upstream identity to a local user.
+func (r *FederationRepository) InsertIdentity(ctx context.Context, identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at`
+
+	args := []any{identity.Provider, identity.Subject, identity.UserID, identity.Email}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, query, args...).Scan(&identity.CreatedAt)
+}
+
+// NewLogin starts a login at the provider, generating and storing its state, nonce and code verifier.
+func (r *FederationRepository) NewLogin(
+	ctx context.Context,
+	provider string,
+	ttl time.Duration,
+) (*FederatedLogin, error) {
+	token, err := generateToken(0, ttl, "")
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomString(16)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	login := &FederatedLogin{
+		State:        token.Plaintext,
+		Hash:         token.Hash,
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Expiry:       token.Expiry,
+	}
+
+	query := `
+		INSERT INTO federated_logins (hash, provider, nonce, code_verifier, expiry)
+		VALUES ($1, $2, $3, $4, $5)`
+
+	args := []any{login.Hash, login.Provider, login.Nonce, login.CodeVerifier, login.Expiry}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err = r.db.ExecContext(ctx, query, args...)
+	return login, err
+}
+
+// ConsumeLogin deletes and returns the unexpired login at the provider matching the state, so that each callback
+// can be completed only once.
+func (r *FederationRepository) ConsumeLogin(ctx context.Context, provider, state string) (*FederatedLogin, error) {
+	query := `
+		DELETE FROM federated_logins
+		WHERE hash = $1 AND provider = $2
+		RETURNING hash, provider, nonce, code_verifier, expiry`
+
+	login := FederatedLogin{State: state}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, hashToken(state), provider).Scan(
+		&login.Hash,
+		&login.Provider,
+		&login.Nonce,
+		&login.CodeVerifier,
+		&login.Expiry,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	if !login.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	return &login, nil
+}
@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/badrchoubai/services/internal/oidc"
+)
+
+const (
+	federatedLoginTTL = 10 * time.Minute
+
+	// federatedLoginCookie holds a hash of the state of the federated login started in the browser, so that the
+	// callback only completes logins the same browser began.
+	federatedLoginCookie = "federated_login_state"
+)
+
+// errUnverifiedEmail is returned when an upstream identity cannot be matched to a local account because the provider
+// did not vouch for its email address.
+var errUnverifiedEmail = errors.New("identity provider did not supply a verified email address")
+
+// startFederatedLogin redirects the user to the upstream identity provider named in the path, setting a cookie that
+// ties the login to the user's browser.
+func (h *handler) startFederatedLogin(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+
+	provider, ok := h.providers[name]
+	if !ok {
+		h.notFoundResponse(w, r)
+		return
+	}
+
+	login, err := h.federation.NewLogin(r.Context(), name, federatedLoginTTL)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), login.State, login.Nonce, codeChallengeS256(login.CodeVerifier))
+	if err != nil {
+		h.identityProviderErrorResponse(w, r, err)
+		return
+	}
+
+	h.setFederatedLoginCookie(w, hex.EncodeToString(hashToken(login.State)), int(federatedLoginTTL.Seconds()))
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// completeFederatedLogin handles the redirect back from an upstream identity provider, exchanging the code for a
+// verified ID token and logging in the local user it identifies.
+func (h *handler) completeFederatedLogin(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("provider")
+
+	provider, ok := h.providers[name]
+	if !ok {
+		h.notFoundResponse(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	// Without this check an attacker could start a login with their own upstream account and have the victim's
+	// browser complete it, logging the victim in as the attacker.
+	cookie, err := r.Cookie(federatedLoginCookie)
+	if err != nil || subtle.ConstantTimeCompare(
+		[]byte(cookie.Value),
+		[]byte(hex.EncodeToString(hashToken(query.Get("state")))),
+	) != 1 {
+		h.errorResponse(w, r, http.StatusBadRequest, "invalid or expired login state")
+		return
+	}
+
+	h.setFederatedLoginCookie(w, "", -1)
+
+	login, err := h.federation.ConsumeLogin(r.Context(), name, query.Get("state"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.errorResponse(w, r, http.StatusBadRequest, "invalid or expired login state")
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if query.Get("error") != "" || query.Get("code") == "" {
+		h.errorResponse(w, r, http.StatusUnauthorized, "the identity provider did not complete the login")
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), login.CodeVerifier, login.Nonce)
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, oidc.ErrExchangeFailed):
+			h.logger.Warn("federated login rejected", zap.String("provider", name), zap.Error(err))
+			h.invalidCredentialsResponse(w, r)
+		default:
+			h.identityProviderErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := h.federatedUser(r.Context(), name, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnverifiedEmail):
+			h.errorResponse(w, r, http.StatusForbidden, err.Error())
+		case errors.Is(err, ErrDuplicateEmail):
+			// The address belongs to a deleted account that has not been purged yet.
+			h.invalidCredentialsResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.DeletedAt != nil {
+		h.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	if !user.Activated {
+		h.inactiveAccountResponse(w, r)
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// setFederatedLoginCookie sets the federated login cookie to value for maxAge seconds, deleting it if maxAge is
+// negative. The cookie has no Path, so the browser scopes it to the federation endpoints of the provider wherever the
+// service is mounted.
+func (h *handler) setFederatedLoginCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     federatedLoginCookie,
+		Value:    value,
+		MaxAge:   maxAge,
+		Secure:   strings.HasPrefix(h.config.OIDCIssuer(), "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// federatedUser returns the local user linked to the upstream identity. An identity seen for the first time is
+// linked to the account with the same verified email address, or to a newly created account if there is none.
+// Linking by email trusts the provider to have verified the address, which also stands in for activation.
+func (h *handler) federatedUser(ctx context.Context, provider string, claims *oidc.Claims) (*User, error) {
+	identity, err := h.federation.GetIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		return h.users.Get(ctx, identity.UserID)
+	}
+	if !errors.Is(err, ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errUnverifiedEmail
+	}
+
+	user, err := h.users.GetByEmail(ctx, claims.Email)
+	switch {
+	case err == nil:
+		if !user.Activated {
+			user.Activated = true
+			if err := h.users.Update(ctx, user); err != nil {
+				return nil, err
+			}
+		}
+	case errors.Is(err, ErrRecordNotFound):
+		if user, err = h.provisionFederatedUser(ctx, claims); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	identity = &Identity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		UserID:   user.ID,
+		Email:    claims.Email,
+	}
+
+	if err := h.federation.InsertIdentity(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// provisionFederatedUser creates an activated account for an upstream identity. The account gets a random password
+// nobody knows, which the user can replace through a password reset if they ever want to log in directly.
+func (h *handler) provisionFederatedUser(ctx context.Context, claims *oidc.Claims) (*User, error) {
+	name := claims.Name
+	if name == "" {
+		name = claims.Email
+	}
+
+	user := &User{
+		Name:      name,
+		Email:     claims.Email,
+		Activated: true,
+	}
+
+	password, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := user.Password.Set(h.hasher, password); err != nil {
+		return nil, err
+	}
+
+	if err := h.users.Insert(ctx, user); err != nil {
+		return nil, err
+	}
+
+	if defaults := h.config.DefaultPermissions(); len(defaults) > 0 {
+		if err := h.permissions.AddForUser(ctx, user.ID, defaults...); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (h *handler) identityProviderErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	h.logError(r, err)
+
+	message := "the identity provider could not be reached, please try again later"
+	h.errorResponse(w, r, http.StatusBadGateway, message)
+}
@@ -0,0 +1,425 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/badrchoubai/services/internal/jwt"
+	"github.com/badrchoubai/services/internal/oidc"
+)
+
+const (
+	mockProvider     = "mock"
+	mockClientID     = "mock-client"
+	mockClientSecret = "mock-client-secret"
+)
+
+// mockIssuer is an upstream OpenID Connect provider serving discovery, its signing keys and a token endpoint that
+// answers every authorization code with the ID token last set by the test.
+type mockIssuer struct {
+	*httptest.Server
+	keys *jwt.KeySet
+
+	mu      sync.Mutex
+	idToken string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+
+	keys, err := jwt.GenerateKeySet()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockIssuer{keys: keys}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, http.StatusOK, map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeMockJSON(w, http.StatusOK, m.keys.JWKS())
+	})
+	mux.HandleFunc("POST /token", m.token)
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	return m
+}
+
+// token redeems any code for the configured ID token, provided the service authenticates as the registered client.
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != mockClientID || secret != mockClientSecret {
+		writeMockJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code_verifier") == "" {
+		writeMockJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	m.mu.Lock()
+	idToken := m.idToken
+	m.mu.Unlock()
+
+	writeMockJSON(w, http.StatusOK, map[string]string{
+		"access_token": "upstream-access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+// claims returns valid ID token claims for the subject, whose email address the provider has verified.
+func (m *mockIssuer) claims(subject, email, nonce string) oidc.Claims {
+	now := time.Now()
+
+	return oidc.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.URL,
+			Subject:   subject,
+			Audience:  jwt.Audience{mockClientID},
+			ExpiresAt: now.Add(time.Hour).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Nonce:         nonce,
+		Name:          "Alice",
+		Email:         email,
+		EmailVerified: true,
+	}
+}
+
+// sign returns the claims as an ID token signed with the provider's key.
+func (m *mockIssuer) sign(t *testing.T, claims oidc.Claims) string {
+	t.Helper()
+
+	token, err := m.keys.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+// setIDToken sets the ID token the token endpoint returns.
+func (m *mockIssuer) setIDToken(idToken string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.idToken = idToken
+}
+
+func writeMockJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// newFederationTestServer starts the auth service with the mock issuer configured as an identity provider.
+func newFederationTestServer(t *testing.T) (*testServer, *mockIssuer) {
+	t.Helper()
+
+	idp := newMockIssuer(t)
+
+	ts := newTestServer(t, map[string]string{
+		"IDENTITY_PROVIDERS":     mockProvider,
+		"IDP_MOCK_CLIENT_ID":     mockClientID,
+		"IDP_MOCK_CLIENT_SECRET": mockClientSecret,
+		"IDP_MOCK_ISSUER":        idp.URL,
+	})
+
+	return ts, idp
+}
+
+// startFederatedLogin begins a login with the mock provider, returning the state and nonce the service sent it.
+func (ts *testServer) startFederatedLogin(t *testing.T, idp *mockIssuer) (string, string) {
+	t.Helper()
+
+	resp, err := ts.noRedirectClient().Get(ts.URL + "/federation/" + mockProvider + "/login")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("starting the login: got status %d, want a redirect", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(location.String(), idp.URL+"/authorize?") {
+		t.Fatalf("redirected to %s, want the provider's authorization endpoint", location)
+	}
+
+	query := location.Query()
+	if query.Get("client_id") != mockClientID || query.Get("code_challenge") == "" {
+		t.Fatalf("incomplete authorization request: %s", location.RawQuery)
+	}
+
+	return query.Get("state"), query.Get("nonce")
+}
+
+// completeFederatedLogin returns to the service from the provider with an authorization code, returning the status
+// code and, on success, the issued tokens.
+func (ts *testServer) completeFederatedLogin(t *testing.T, state string) (int, *loginResponse) {
+	t.Helper()
+
+	query := url.Values{"state": {state}, "code": {"upstream-code"}}
+
+	var tokens loginResponse
+	status := ts.do(t, http.MethodGet, "/federation/"+mockProvider+"/callback?"+query.Encode(), "", nil, &tokens)
+
+	return status, &tokens
+}
+
+// federatedLogin logs in through the mock provider as the subject, returning the status code and the issued tokens.
+func (ts *testServer) federatedLogin(t *testing.T, idp *mockIssuer, subject, email string) (int, *loginResponse) {
+	t.Helper()
+
+	state, nonce := ts.startFederatedLogin(t, idp)
+	idp.setIDToken(idp.sign(t, idp.claims(subject, email, nonce)))
+
+	return ts.completeFederatedLogin(t, state)
+}
+
+// linkedUser returns the ID of the user the subject's identity at the mock provider is linked to.
+func (ts *testServer) linkedUser(t *testing.T, subject string) int64 {
+	t.Helper()
+
+	identity, err := NewFederationRepository(ts.db).GetIdentity(context.Background(), mockProvider, subject)
+	if err != nil {
+		t.Fatalf("looking up identity %s: %v", subject, err)
+	}
+
+	return identity.UserID
+}
+
+// count returns the number of rows in the table.
+func (ts *testServer) count(t *testing.T, table string) int {
+	t.Helper()
+
+	var n int
+	if err := ts.db.QueryRow("SELECT count(*) FROM " + table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func TestFederatedLoginCreatesUser(t *testing.T) {
+	ts, idp := newFederationTestServer(t)
+
+	status, tokens := ts.federatedLogin(t, idp, "subject-1", testEmail)
+	if status != http.StatusCreated {
+		t.Fatalf("first login: got status %d", status)
+	}
+
+	var me struct {
+		User User `json:"user"`
+	}
+	status = ts.do(t, http.MethodGet, "/users/me", tokens.AuthenticationToken.Token, nil, &me)
+	if status != http.StatusOK {
+		t.Fatalf("using the token: got status %d", status)
+	}
+
+	if me.User.Email != testEmail || !me.User.Activated {
+		t.Errorf("got user %q, activated %t; want an activated %q", me.User.Email, me.User.Activated, testEmail)
+	}
+
+	if id := ts.linkedUser(t, "subject-1"); id != me.User.ID {
+		t.Errorf("identity linked to user %d, want %d", id, me.User.ID)
+	}
+
+	// Logging in again reuses the link rather than provisioning another user.
+	if status, _ := ts.federatedLogin(t, idp, "subject-1", testEmail); status != http.StatusCreated {
+		t.Fatalf("second login: got status %d", status)
+	}
+
+	if n := ts.count(t, "users"); n != 1 {
+		t.Errorf("got %d users, want 1", n)
+	}
+
+	if n := ts.count(t, "user_identities"); n != 1 {
+		t.Errorf("got %d identities, want 1", n)
+	}
+}
+
+func TestFederatedLoginLinksExistingUser(t *testing.T) {
+	ts, idp := newFederationTestServer(t)
+
+	userID := ts.createActivatedUser(t, "Alice", testEmail, testPassword)
+
+	if status, _ := ts.federatedLogin(t, idp, "subject-1", testEmail); status != http.StatusCreated {
+		t.Fatalf("logging in: got status %d", status)
+	}
+
+	if id := ts.linkedUser(t, "subject-1"); id != userID {
+		t.Errorf("identity linked to user %d, want the existing user %d", id, userID)
+	}
+
+	if n := ts.count(t, "users"); n != 1 {
+		t.Errorf("got %d users, want 1", n)
+	}
+
+	// The local password keeps working alongside the linked identity.
+	if status, _ := ts.login(t, testEmail, testPassword); status != http.StatusCreated {
+		t.Errorf("logging in with the password: got status %d", status)
+	}
+}
+
+func TestFederatedLoginRejectsInvalidIDTokens(t *testing.T) {
+	ts, idp := newFederationTestServer(t)
+
+	tests := []struct {
+		name    string
+		idToken func(claims oidc.Claims) string
+		want    int
+	}{
+		{
+			name: "bad signature",
+			idToken: func(claims oidc.Claims) string {
+				// Graft the signature of the genuine token onto a payload naming another subject.
+				genuine := strings.Split(idp.sign(t, claims), ".")
+				claims.Subject = "someone-else"
+				forged := strings.Split(idp.sign(t, claims), ".")
+
+				return forged[0] + "." + forged[1] + "." + genuine[2]
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong audience",
+			idToken: func(claims oidc.Claims) string {
+				claims.Audience = jwt.Audience{"another-client"}
+				return idp.sign(t, claims)
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong nonce",
+			idToken: func(claims oidc.Claims) string {
+				claims.Nonce = "not-the-nonce"
+				return idp.sign(t, claims)
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong issuer",
+			idToken: func(claims oidc.Claims) string {
+				claims.Issuer = "https://attacker.example.com"
+				return idp.sign(t, claims)
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "expired",
+			idToken: func(claims oidc.Claims) string {
+				claims.ExpiresAt = time.Now().Add(-time.Hour).Unix()
+				return idp.sign(t, claims)
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "no expiry",
+			idToken: func(claims oidc.Claims) string {
+				claims.ExpiresAt = 0
+				return idp.sign(t, claims)
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "no issued at",
+			idToken: func(claims oidc.Claims) string {
+				claims.IssuedAt = 0
+				return idp.sign(t, claims)
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name: "unverified email",
+			idToken: func(claims oidc.Claims) string {
+				claims.EmailVerified = false
+				return idp.sign(t, claims)
+			},
+			want: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, nonce := ts.startFederatedLogin(t, idp)
+			idp.setIDToken(tt.idToken(idp.claims("subject-1", testEmail, nonce)))
+
+			if status, _ := ts.completeFederatedLogin(t, state); status != tt.want {
+				t.Errorf("got status %d, want %d", status, tt.want)
+			}
+		})
+	}
+
+	if n := ts.count(t, "users"); n != 0 {
+		t.Errorf("got %d users, want none", n)
+	}
+
+	if n := ts.count(t, "user_identities"); n != 0 {
+		t.Errorf("got %d identities, want none", n)
+	}
+
+	// The state is spent once the provider has returned, whatever the outcome.
+	state, nonce := ts.startFederatedLogin(t, idp)
+	idp.setIDToken(idp.sign(t, idp.claims("subject-1", testEmail, nonce)))
+
+	if status, _ := ts.completeFederatedLogin(t, state); status != http.StatusCreated {
+		t.Fatalf("logging in: got status %d", status)
+	}
+
+	if status, _ := ts.completeFederatedLogin(t, state); status != http.StatusBadRequest {
+		t.Errorf("replaying the state: got status %d", status)
+	}
+}
+
+func TestFederatedLoginRequiresStartingBrowser(t *testing.T) {
+	ts, idp := newFederationTestServer(t)
+
+	state, nonce := ts.startFederatedLogin(t, idp)
+	idp.setIDToken(idp.sign(t, idp.claims("subject-1", testEmail, nonce)))
+
+	// A browser that did not start the login, such as a victim's lured to the callback, lacks its cookie.
+	query := url.Values{"state": {state}, "code": {"upstream-code"}}
+
+	resp, err := http.Get(ts.URL + "/federation/" + mockProvider + "/callback?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("completing the login from another browser: got status %d", resp.StatusCode)
+	}
+
+	if n := ts.count(t, "users"); n != 0 {
+		t.Errorf("got %d users, want none", n)
+	}
+
+	// The rejected attempt leaves the login for the browser that started it.
+	if status, _ := ts.completeFederatedLogin(t, state); status != http.StatusCreated {
+		t.Errorf("completing the login: got status %d", status)
+	}
+}
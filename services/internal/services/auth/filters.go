@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+// maxPageSize bounds how many records a single page of a listing may hold.
+const maxPageSize = 100
+
+// Filters holds the pagination and sorting parameters of a listing. Sort names a key of SortColumns, prefixed with
+// "-" for descending order.
+type Filters struct {
+	Page        int
+	PageSize    int
+	Sort        string
+	SortColumns map[string]string
+}
+
+// ValidateFilters checks that the page is in range and that the sort key is one the listing supports.
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "pageSize", "must be greater than zero")
+	v.Check(f.PageSize <= maxPageSize, "pageSize", "must be a maximum of 100")
+
+	_, ok := f.SortColumns[strings.TrimPrefix(f.Sort, "-")]
+	v.Check(ok, "sort", "must be one of "+strings.Join(f.sortKeys(), ", "))
+}
+
+// sortColumn returns the column to order by. Since its result is interpolated into SQL, it panics on a sort key that
+// ValidateFilters would have rejected rather than trusting it.
+func (f Filters) sortColumn() string {
+	column, ok := f.SortColumns[strings.TrimPrefix(f.Sort, "-")]
+	if !ok {
+		panic("unsafe sort parameter: " + f.Sort)
+	}
+
+	return column
+}
+
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+func (f Filters) sortKeys() []string {
+	keys := make([]string, 0, 2*len(f.SortColumns))
+	for key := range f.SortColumns {
+		keys = append(keys, key, "-"+key)
+	}
+	slices.Sort(keys)
+
+	return keys
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata describes where a page sits within a listing. It is empty when the listing has no records.
+type Metadata struct {
+	CurrentPage  int `json:"currentPage,omitempty"`
+	PageSize     int `json:"pageSize,omitempty"`
+	FirstPage    int `json:"firstPage,omitempty"`
+	LastPage     int `json:"lastPage,omitempty"`
+	TotalRecords int `json:"totalRecords,omitempty"`
+}
+
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
+
+// likePattern returns a pattern for ILIKE matching s anywhere in a value, with the wildcards in s escaped.
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+// CursorMetadata describes a page of a listing paginated by cursor. NextCursor is passed as the cursor parameter to
+// fetch the following page, and is omitted on the last one.
+type CursorMetadata struct {
+	PageSize   int   `json:"pageSize"`
+	NextCursor int64 `json:"nextCursor,omitempty"`
+}
@@ -1,11 +1,276 @@
 package auth
 
 import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/badrchoubai/services/internal/config"
+	"github.com/badrchoubai/services/internal/encoding"
+	"github.com/badrchoubai/services/internal/jwt"
+	"github.com/badrchoubai/services/internal/mailer"
+	"github.com/badrchoubai/services/internal/middleware"
+	"github.com/badrchoubai/services/internal/oidc"
+	"github.com/badrchoubai/services/internal/passwords"
 	"github.com/badrchoubai/services/internal/service"
+	"github.com/badrchoubai/services/internal/validator"
 )
 
-func addRoutes(svc *service.Service) {
+type envelope map[string]any
+
+type handler struct {
+	auditor        *Auditor
+	background     func(fn func())
+	config         *config.AppConfig
+	encoderDecoder encoding.EncoderDecoder
+	hasher         *passwords.Hasher
+	keys           *jwt.KeySet
+	logger         *zap.Logger
+	mailer         mailer.Mailer
+	name           string
+	passwords      *passwords.Policy
+	path           string
+	providers      map[string]*oidc.Provider
+
+	apiKeys       *APIKeyRepository
+	auditEvents   *AuditEventRepository
+	clients       *ClientRepository
+	codes         *AuthorizationCodeRepository
+	federation    *FederationRepository
+	loginAttempts *LoginAttemptRepository
+	mfa           *MFARepository
+	permissions   *PermissionRepository
+	tokens        *TokenRepository
+	users         *UserRepository
+}
+
+func newHandler(
+	svc *service.Service,
+	cfg *config.AppConfig,
+	m mailer.Mailer,
+	keys *jwt.KeySet,
+	passwords *passwords.Policy,
+	hasher *passwords.Hasher,
+) *handler {
+	db := svc.Database().DB()
+
+	return &handler{
+		auditor:        NewAuditor(cfg, NewAuditEventRepository(db), svc.Logger()),
+		background:     svc.Background,
+		config:         cfg,
+		encoderDecoder: svc.EncoderDecoder(),
+		hasher:         hasher,
+		keys:           keys,
+		logger:         svc.Logger(),
+		mailer:         m,
+		name:           svc.Name(),
+		passwords:      passwords,
+		path:           svc.Path(),
+		providers:      newIdentityProviders(cfg),
+		apiKeys:        NewAPIKeyRepository(db),
+		auditEvents:    NewAuditEventRepository(db),
+		clients:        NewClientRepository(db),
+		codes:          NewAuthorizationCodeRepository(db),
+		federation:     NewFederationRepository(db),
+		loginAttempts:  NewLoginAttemptRepository(db),
+		mfa:            NewMFARepository(db),
+		permissions:    NewPermissionRepository(db),
+		tokens:         NewTokenRepository(db),
+		users:          NewUserRepository(db),
+	}
+}
+
+func addRoutes(svc *service.Service, h *handler) {
+	svc.Mux().HandleFunc("POST /users", h.registerUser)
+	svc.Mux().HandleFunc("PUT /users/activated", h.activateUser)
+	svc.Mux().HandleFunc("PUT /users/password", h.updateUserPassword)
+	svc.Mux().HandleFunc("PUT /users/email", h.confirmEmailChange)
+	svc.Mux().HandleFunc("POST /tokens/authentication", h.createAuthenticationToken)
+	svc.Mux().HandleFunc("POST /tokens/authentication/mfa", h.createMFAAuthenticationToken)
+	svc.Mux().HandleFunc("POST /tokens/password-reset", h.createPasswordResetToken)
+	svc.Mux().HandleFunc("POST /tokens/refresh", h.refreshAuthenticationToken)
+	svc.Mux().HandleFunc("GET /.well-known/jwks.json", h.showJWKS)
+	svc.Mux().HandleFunc("GET /.well-known/openid-configuration", h.showOpenIDConfiguration)
+	svc.Mux().HandleFunc("GET /federation/{provider}/login", h.startFederatedLogin)
+	svc.Mux().HandleFunc("GET /federation/{provider}/callback", h.completeFederatedLogin)
+	svc.Mux().HandleFunc("GET /oauth2/authorize", h.authorize)
+	svc.Mux().HandleFunc("POST /oauth2/authorize", h.approveAuthorization)
+	svc.Mux().HandleFunc("POST /oauth2/token", h.createOAuthToken)
+	svc.Mux().HandleFunc("POST /oauth2/revoke", h.revokeOAuthToken)
+	svc.Mux().HandleFunc("POST /oauth2/introspect", h.introspectOAuthToken)
+
+	svc.Mux().HandleFunc("GET /users/me", middleware.RequireActivatedUser(h.showCurrentUser))
+	svc.Mux().HandleFunc("PATCH /users/me", middleware.RequireActivatedUser(h.updateCurrentUser))
+	svc.Mux().HandleFunc("DELETE /users/me", middleware.RequireActivatedUser(h.deleteCurrentUser))
+	svc.Mux().HandleFunc("GET /users/me/export", middleware.RequireActivatedUser(h.exportCurrentUser))
+	svc.Mux().HandleFunc("POST /users/email", middleware.RequireActivatedUser(h.requestEmailChange))
+	svc.Mux().HandleFunc("POST /users/me/mfa/totp", middleware.RequireActivatedUser(h.startTOTPEnrollment))
+	svc.Mux().HandleFunc("POST /users/me/mfa/totp/confirm", middleware.RequireActivatedUser(h.confirmTOTPEnrollment))
+	svc.Mux().HandleFunc("GET /oauth2/userinfo", middleware.RequireScope(oidcScopeOpenID, h.showUserInfo))
+	svc.Mux().HandleFunc("POST /oauth2/userinfo", middleware.RequireScope(oidcScopeOpenID, h.showUserInfo))
+	svc.Mux().HandleFunc("POST /api-keys", middleware.RequireActivatedUser(h.createAPIKey))
+	svc.Mux().HandleFunc("GET /api-keys", middleware.RequireActivatedUser(h.listAPIKeys))
+	svc.Mux().HandleFunc("DELETE /api-keys/{id}", middleware.RequireActivatedUser(h.deleteAPIKey))
+	svc.Mux().HandleFunc("GET /sessions", middleware.RequireAuthenticatedUser(h.listSessions))
+	svc.Mux().HandleFunc("DELETE /tokens", middleware.RequireAuthenticatedUser(h.deleteAllTokens))
+	svc.Mux().HandleFunc("DELETE /tokens/current", middleware.RequireAuthenticatedUser(h.deleteCurrentToken))
+
+	svc.Mux().HandleFunc(
+		"GET /users",
+		middleware.RequirePermission(PermissionUsersRead, h.listUsers),
+	)
+	svc.Mux().HandleFunc(
+		"GET /users/{id}",
+		middleware.RequirePermission(PermissionUsersRead, h.showUser),
+	)
+	svc.Mux().HandleFunc(
+		"PATCH /users/{id}",
+		middleware.RequirePermission(PermissionUsersWrite, h.updateUserByAdmin),
+	)
+	svc.Mux().HandleFunc(
+		"DELETE /users/{id}",
+		middleware.RequirePermission(PermissionUsersWrite, h.deleteUser),
+	)
+	svc.Mux().HandleFunc(
+		"POST /users/{id}/deactivate",
+		middleware.RequirePermission(PermissionUsersWrite, h.deactivateUser),
+	)
+	svc.Mux().HandleFunc(
+		"POST /users/{id}/reactivate",
+		middleware.RequirePermission(PermissionUsersWrite, h.reactivateUser),
+	)
+	svc.Mux().HandleFunc(
+		"POST /users/{id}/restore",
+		middleware.RequirePermission(PermissionUsersWrite, h.restoreUser),
+	)
+	svc.Mux().HandleFunc(
+		"POST /users/{id}/password-reset",
+		middleware.RequirePermission(PermissionUsersWrite, h.forcePasswordReset),
+	)
+	svc.Mux().HandleFunc(
+		"GET /users/{id}/permissions",
+		middleware.RequirePermission(PermissionUsersRead, h.listUserPermissions),
+	)
+	svc.Mux().HandleFunc(
+		"POST /users/{id}/permissions",
+		middleware.RequirePermission(PermissionUsersWrite, h.grantUserPermissions),
+	)
+	svc.Mux().HandleFunc(
+		"DELETE /users/{id}/permissions/{code}",
+		middleware.RequirePermission(PermissionUsersWrite, h.revokeUserPermission),
+	)
+	svc.Mux().HandleFunc(
+		"DELETE /users/{id}/lockout",
+		middleware.RequirePermission(PermissionUsersWrite, h.unlockUser),
+	)
+	svc.Mux().HandleFunc(
+		"POST /oauth2/clients",
+		middleware.RequirePermission(PermissionClientsWrite, h.registerClient),
+	)
+	svc.Mux().HandleFunc(
+		"DELETE /oauth2/clients/{id}",
+		middleware.RequirePermission(PermissionClientsWrite, h.deleteClient),
+	)
+	svc.Mux().HandleFunc(
+		"GET /audit-events",
+		middleware.RequirePermission(PermissionAuditRead, h.listAuditEvents),
+	)
 	svc.Mux().Handle("/", http.NotFoundHandler())
 }
+
+func (h *handler) encode(w http.ResponseWriter, r *http.Request, status int, data envelope) {
+	if err := h.encoderDecoder.EncodeResponse(w, status, data); err != nil {
+		h.logError(r, err)
+	}
+}
+
+func readIDParam(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+
+	return id, nil
+}
+
+// readString returns the query string value for key, or defaultValue if it is absent.
+func readString(qs url.Values, key, defaultValue string) string {
+	if s := qs.Get(key); s != "" {
+		return s
+	}
+
+	return defaultValue
+}
+
+// readInt returns the query string value for key as an integer, or defaultValue if it is absent. A value that is not
+// an integer is recorded on v.
+func readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// readBool returns the query string value for key as a boolean, or nil if it is absent. A value that is not a boolean
+// is recorded on v.
+func readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
+// readTime returns the query string value for key as an RFC 3339 time, or nil if it is absent. A value that is not
+// such a time is recorded on v.
+func readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 time")
+		return nil
+	}
+
+	return &t
+}
+
+// sendEmail renders the template and delivers it to recipient in the background, logging any failure.
+func (h *handler) sendEmail(recipient, templateFile string, data any) {
+	h.background(func() {
+		msg, err := mailer.NewMessage(recipient, templateFile, data)
+		if err == nil {
+			err = h.mailer.Send(context.Background(), msg)
+		}
+
+		if err != nil {
+			h.logger.Error(
+				"sending email",
+				zap.String("template", templateFile),
+				zap.Error(err),
+			)
+		}
+	})
+}
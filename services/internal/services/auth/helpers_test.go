@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"go.uber.org/zap"
+	"maps"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/badrchoubai/services/internal/config"
+	"github.com/badrchoubai/services/internal/database"
+	"github.com/badrchoubai/services/internal/mailer"
+)
+
+// testDatabaseEnv names the environment variable holding the connection string of a PostgreSQL database the tests
+// may create schemas in. Tests that need a database are skipped when it is unset.
+const testDatabaseEnv = "TEST_DB_CONNECTION_STRING"
+
+const (
+	testEmail    = "alice@example.com"
+	testPassword = "correct-horse-battery-staple"
+)
+
+// emailTokenRX matches the token quoted in the activation and password reset emails.
+var emailTokenRX = regexp.MustCompile(`"token": "([A-Z2-7]{26})"`)
+
+// testServer runs the auth service against a schema of its own, delivering email to an in-memory mailer.
+type testServer struct {
+	*httptest.Server
+	db     *sql.DB
+	mailer *mailer.MemoryMailer
+}
+
+// newTestServer starts the auth service on a fresh, fully migrated schema. env overrides the configuration the tests
+// otherwise share, such as the cheap password hashing that keeps them fast and the lack of a delay after a failed
+// login.
+func newTestServer(t *testing.T, env map[string]string) *testServer {
+	t.Helper()
+
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseEnv)
+	}
+
+	dsn = withSearchPath(t, dsn, newTestSchema(t, dsn))
+
+	srv := httptest.NewUnstartedServer(nil)
+
+	settings := map[string]string{
+		"ACCOUNT_DELETION_GRACE_PERIOD": "0",
+		"DB_CONNECTION_STRING":          dsn,
+		"LOGIN_BACKOFF_BASE":            "0",
+		"MAILER_DRIVER":                 mailer.DriverMemory,
+		"OIDC_ISSUER":                   "http://" + srv.Listener.Addr().String(),
+		"PASSWORD_BCRYPT_COST":          "4",
+		"PASSWORD_HASH_ALGORITHM":       "bcrypt",
+	}
+	maps.Copy(settings, env)
+
+	for key, value := range settings {
+		t.Setenv(key, value)
+	}
+
+	cfg, err := config.NewConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	db, err := database.NewDatabase(ctx, cfg)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+
+	migrate(t, db.DB())
+
+	m := mailer.NewMemoryMailer()
+
+	svc, err := newAuthService(ctx, cfg, zap.NewNop(), db, m)
+	if err != nil {
+		cancel()
+		t.Fatal(err)
+	}
+
+	srv.Config.Handler = svc.Handler()
+	srv.Start()
+
+	// Like a browser, the client keeps the cookies the service sets, such as the one binding a federated login to
+	// the client that started it.
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Client().Jar = jar
+
+	t.Cleanup(func() {
+		srv.Close()
+		cancel()
+		svc.Wait()
+		_ = db.Close()
+	})
+
+	return &testServer{Server: srv, db: db.DB(), mailer: m}
+}
+
+// newTestSchema creates a schema that is dropped when the test ends, so that tests never see each other's data.
+func newTestSchema(t *testing.T, dsn string) string {
+	t.Helper()
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := fmt.Sprintf("auth_test_%d", time.Now().UnixNano())
+
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		_ = admin.Close()
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Error(err)
+		}
+		_ = admin.Close()
+	})
+
+	return schema
+}
+
+// withSearchPath returns dsn, in either URL or keyword/value form, with the schema as its search path.
+func withSearchPath(t *testing.T, dsn, schema string) string {
+	t.Helper()
+
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// migrate applies every up migration in order.
+func migrate(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	files, err := filepath.Glob("../../../migrations/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) == 0 {
+		t.Fatal("no migrations found")
+	}
+
+	slices.Sort(files)
+
+	for _, file := range files {
+		migration, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec(string(migration)); err != nil {
+			t.Fatalf("applying %s: %v", filepath.Base(file), err)
+		}
+	}
+}
+
+// do sends a request with a JSON body, unless body is nil, authenticated with the bearer token, unless it is empty.
+// The response body is decoded into dst, unless it is nil, and the status code returned.
+func (ts *testServer) do(t *testing.T, method, path, token string, body, dst any) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		js, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(js)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, ts.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return ts.send(t, req, dst)
+}
+
+// postForm sends a form to the path, authenticated with the client's credentials unless clientID is empty. The
+// response body is decoded into dst, unless it is nil, and the status code returned.
+func (ts *testServer) postForm(t *testing.T, path string, form url.Values, clientID, secret string, dst any) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if clientID != "" {
+		req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(secret))
+	}
+
+	return ts.send(t, req, dst)
+}
+
+func (ts *testServer) send(t *testing.T, req *http.Request, dst any) int {
+	t.Helper()
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if dst != nil {
+		if err := json.NewDecoder(resp.Body).Decode(dst); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", req.Method, req.URL.Path, err)
+		}
+	}
+
+	return resp.StatusCode
+}
+
+// noRedirectClient returns a client that hands redirects back to the test rather than following them.
+func (ts *testServer) noRedirectClient() *http.Client {
+	client := *ts.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &client
+}
+
+// waitForEmail returns the nth email, counting from one, sent to the recipient. Email is sent in the background, so
+// it waits a few seconds for the message to arrive.
+func (ts *testServer) waitForEmail(t *testing.T, recipient string, n int) mailer.Message {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		var received []mailer.Message
+		for _, msg := range ts.mailer.Messages() {
+			if msg.To == recipient {
+				received = append(received, msg)
+			}
+		}
+
+		if len(received) >= n {
+			return received[n-1]
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("email %d to %s was not sent, got %d", n, recipient, len(received))
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// emailToken returns the token quoted in the message.
+func emailToken(t *testing.T, msg mailer.Message) string {
+	t.Helper()
+
+	match := emailTokenRX.FindStringSubmatch(msg.PlainBody)
+	if match == nil {
+		t.Fatalf("no token in email %q", msg.Subject)
+	}
+
+	return match[1]
+}
+
+// createActivatedUser registers a user and activates their account with the token from the welcome email, returning
+// the user's ID.
+func (ts *testServer) createActivatedUser(t *testing.T, name, email, password string) int64 {
+	t.Helper()
+
+	var registered struct {
+		User struct {
+			ID int64 `json:"id"`
+		} `json:"user"`
+	}
+
+	input := map[string]string{"name": name, "email": email, "password": password}
+	if status := ts.do(t, http.MethodPost, "/users", "", input, &registered); status != http.StatusCreated {
+		t.Fatalf("registering user: got status %d", status)
+	}
+
+	token := emailToken(t, ts.waitForEmail(t, email, 1))
+
+	input = map[string]string{"token": token}
+	if status := ts.do(t, http.MethodPut, "/users/activated", "", input, nil); status != http.StatusOK {
+		t.Fatalf("activating user: got status %d", status)
+	}
+
+	return registered.User.ID
+}
+
+// loginResponse is the body of a successful login.
+type loginResponse struct {
+	AuthenticationToken struct {
+		Token string `json:"token"`
+	} `json:"authenticationToken"`
+	RefreshToken struct {
+		Token string `json:"token"`
+	} `json:"refreshToken"`
+}
+
+// login logs the user in with their password, returning the status code and, on success, the issued tokens.
+func (ts *testServer) login(t *testing.T, email, password string) (int, *loginResponse) {
+	t.Helper()
+
+	input := map[string]string{"email": email, "password": password}
+
+	var tokens loginResponse
+	status := ts.do(t, http.MethodPost, "/tokens/authentication", "", input, &tokens)
+
+	return status, &tokens
+}
+
+// createClient registers an OAuth2 client directly in the database, setting its ID and returning its secret, which is
+// empty for public clients.
+func (ts *testServer) createClient(t *testing.T, client *Client, public bool) string {
+	t.Helper()
+
+	id, secret, err := generateClientCredentials()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client.ID = id
+	if !public {
+		client.SecretHash = hashToken(secret)
+	}
+
+	if err := NewClientRepository(ts.db).Insert(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+
+	if public {
+		return ""
+	}
+
+	return secret
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"github.com/tomasen/realip"
+	"go.uber.org/zap"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// loginRetryAfter returns how long the caller must wait before they may attempt to log in to the account with the
+// given email address, taking into account both the account and the caller's IP address.
+func (h *handler) loginRetryAfter(r *http.Request, email string) (time.Duration, error) {
+	attempts, err := h.loginAttempts.Get(r.Context(), emailAttemptKey(email), ipAttemptKey(realip.FromRequest(r)))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+
+	var wait time.Duration
+	for _, attempt := range attempts {
+		wait = max(wait, attempt.RetryAfter(now, h.config.LoginBackoffBase(), h.config.LoginLockoutDuration()))
+	}
+
+	return wait, nil
+}
+
+// recordFailedLogin counts a failed login against the account and the caller's IP address, locking either out once it
+// reaches its limit. user is nil when no account has the email address.
+func (h *handler) recordFailedLogin(r *http.Request, email string, user *User) error {
+	ip := realip.FromRequest(r)
+	duration := h.config.LoginLockoutDuration()
+
+	var userID *int64
+	if user != nil {
+		userID = &user.ID
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionLogin, TargetID: userID, Target: email, Outcome: AuditOutcomeFailure})
+
+	attempt, err := h.loginAttempts.RecordFailure(r.Context(), emailAttemptKey(email), duration)
+	if err != nil {
+		return err
+	}
+
+	if attempt.Failures >= h.config.LoginMaxAttempts() {
+		if err := h.loginAttempts.Lock(r.Context(), attempt.Key, time.Now().Add(duration)); err != nil {
+			return err
+		}
+
+		h.logger.Warn(
+			"account locked after repeated failed logins",
+			zap.String("ip", ip),
+			zap.Int("failures", attempt.Failures),
+		)
+
+		h.audit(r, &AuditEvent{
+			Action:   AuditActionAccountLockout,
+			TargetID: userID,
+			Target:   email,
+			Outcome:  AuditOutcomeSuccess,
+		})
+
+		if user != nil && h.config.LoginLockoutNotify() {
+			h.sendEmail(user.Email, "security_notice.tmpl", map[string]any{
+				"Name":  user.Name,
+				"Event": "Your account was temporarily locked after repeated failed login attempts.",
+				"Time":  time.Now().UTC().Format(time.RFC1123),
+				"IP":    ip,
+			})
+		}
+	}
+
+	attempt, err = h.loginAttempts.RecordFailure(r.Context(), ipAttemptKey(ip), duration)
+	if err != nil {
+		return err
+	}
+
+	if attempt.Failures >= h.config.LoginMaxAttemptsPerIP() {
+		if err := h.loginAttempts.Lock(r.Context(), attempt.Key, time.Now().Add(duration)); err != nil {
+			return err
+		}
+
+		h.logger.Warn("ip address locked out after repeated failed logins", zap.String("ip", ip))
+	}
+
+	return nil
+}
+
+// resetFailedLogins forgets the failed logins recorded against an account once its owner has logged in.
+func (h *handler) resetFailedLogins(r *http.Request, email string) error {
+	return h.loginAttempts.Reset(r.Context(), emailAttemptKey(email))
+}
+
+// confirmPassword checks the password a logged in user re-entered before a sensitive change, which keeps a stolen
+// session from being turned into a stolen account. Guesses are throttled the same way as logins. It writes an error
+// response and returns false unless the password matches.
+func (h *handler) confirmPassword(w http.ResponseWriter, r *http.Request, user *User, password string) bool {
+	retryAfter, err := h.loginRetryAfter(r, user.Email)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if retryAfter > 0 {
+		h.tooManyLoginAttemptsResponse(w, r, retryAfter)
+		return false
+	}
+
+	match, _, err := user.Password.Matches(h.hasher, password)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !match {
+		if err := h.recordFailedLogin(r, user.Email, user); err != nil {
+			h.serverErrorResponse(w, r, err)
+			return false
+		}
+		h.failedValidationResponse(w, r, map[string]string{"password": "is incorrect"})
+		return false
+	}
+
+	return true
+}
+
+func (h *handler) unlockUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.resetFailedLogins(r, user.Email); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionAccountUnlock, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	h.encode(w, r, http.StatusOK, envelope{"message": "the account has been unlocked"})
+}
+
+func (h *handler) tooManyLoginAttemptsResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	message := "too many failed login attempts, please try again later"
+	h.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
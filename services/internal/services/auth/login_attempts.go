@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"time"
+)
+
+// LoginAttempt counts the consecutive failed logins for an account or an IP address.
+type LoginAttempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// RetryAfter returns how long the caller must wait before trying again: until the lock expires if there is one,
+// otherwise until an exponential backoff of base doubled for each failure after the first, capped at limit, has
+// passed since the last failure. It returns zero if another attempt is allowed now.
+func (a *LoginAttempt) RetryAfter(now time.Time, base, limit time.Duration) time.Duration {
+	if a.LockedUntil != nil && a.LockedUntil.After(now) {
+		return a.LockedUntil.Sub(now)
+	}
+
+	if a.Failures == 0 {
+		return 0
+	}
+
+	backoff := limit
+	if shift := a.Failures - 1; shift < 32 {
+		backoff = min(base<<shift, limit)
+	}
+
+	return max(a.LastFailureAt.Add(backoff).Sub(now), 0)
+}
+
+// emailAttemptKey returns the key failed logins for an email address are counted under. Addresses that do not belong
+// to any account are counted too, so that responses do not reveal which addresses are registered. The address is used
+// exactly as given, since email addresses are matched case-sensitively when looking up an account.
+func emailAttemptKey(email string) string {
+	return "email:" + email
+}
+
+// ipAttemptKey returns the key failed logins from an IP address are counted under.
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginAttemptRepository provides access to the login_attempts table.
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+// NewLoginAttemptRepository returns a LoginAttemptRepository backed by the given database handle.
+func NewLoginAttemptRepository(db *sql.DB) *LoginAttemptRepository {
+	return &LoginAttemptRepository{db: db}
+}
+
+// Get returns the recorded attempts for each of the keys that has any.
+func (r *LoginAttemptRepository) Get(ctx context.Context, keys ...string) ([]*LoginAttempt, error) {
+	query := `
+		SELECT key, failures, last_failure_at, locked_until
+		FROM login_attempts
+		WHERE key = ANY($1)`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []*LoginAttempt{}
+
+	for rows.Next() {
+		var attempt LoginAttempt
+
+		err := rows.Scan(&attempt.Key, &attempt.Failures, &attempt.LastFailureAt, &attempt.LockedUntil)
+		if err != nil {
+			return nil, err
+		}
+
+		attempts = append(attempts, &attempt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attempts, nil
+}
+
+// RecordFailure counts a failed login against the key. Failures older than window are forgotten, so the count starts
+// over once an attacker has been quiet for that long.
+func (r *LoginAttemptRepository) RecordFailure(
+	ctx context.Context,
+	key string,
+	window time.Duration,
+) (*LoginAttempt, error) {
+	query := `
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, NOW())
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE
+				WHEN login_attempts.last_failure_at < NOW() - make_interval(secs => $2) THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = NOW()
+		RETURNING key, failures, last_failure_at, locked_until`
+
+	var attempt LoginAttempt
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, key, window.Seconds()).Scan(
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.LastFailureAt,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+// Lock prevents any login attempt against the key until the given time.
+func (r *LoginAttemptRepository) Lock(ctx context.Context, key string, until time.Time) error {
+	query := `
+		UPDATE login_attempts
+		SET locked_until = $2
+		WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, key, until)
+	return err
+}
+
+// Reset forgets every failure and lock recorded against the key.
+func (r *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	query := `
+		DELETE FROM login_attempts
+		WHERE key = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, key)
+	return err
+}
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const (
+	// ScopeMFAPending is the scope of short-lived tokens issued after a correct password for an account enrolled in
+	// multi-factor authentication, to be exchanged for a full authentication token with a second factor.
+	ScopeMFAPending = "mfa-pending"
+
+	// recoveryCodeCount is the number of recovery codes issued when enrollment is confirmed.
+	recoveryCodeCount = 10
+)
+
+var (
+	// ErrMFAAlreadyEnrolled is returned when starting enrollment for a user with a confirmed TOTP secret.
+	ErrMFAAlreadyEnrolled = errors.New("mfa already enrolled")
+
+	totpCodeRX = regexp.MustCompile(`^[0-9]{6}$`)
+)
+
+// TOTPEnrollment is a user's TOTP secret and whether it has been confirmed with a first code.
+type TOTPEnrollment struct {
+	UserID       int64
+	Secret       []byte
+	CreatedAt    time.Time
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+}
+
+// Confirmed reports whether the enrollment has been confirmed and is required at login.
+func (e *TOTPEnrollment) Confirmed() bool {
+	return e.ConfirmedAt != nil
+}
+
+// ValidateTOTPCode checks that a code has the six digit format produced by authenticator apps.
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(validator.Matches(code, totpCodeRX), "code", "must be a 6 digit code")
+}
+
+// generateRecoveryCodes returns recoveryCodeCount codes of the form XXXXX-XXXXX.
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+
+	for range recoveryCodeCount {
+		randomBytes := make([]byte, 7)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return nil, err
+		}
+
+		code := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode upper-cases a recovery code and strips separators and whitespace so that codes are accepted
+// however the user typed them.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// MFARepository provides access to the users_totp and recovery_codes tables.
+type MFARepository struct {
+	db *sql.DB
+}
+
+// NewMFARepository returns an MFARepository backed by the given database handle.
+func NewMFARepository(db *sql.DB) *MFARepository {
+	return &MFARepository{db: db}
+}
+
+// GetTOTP returns the user's TOTP enrollment, or ErrRecordNotFound.
+func (r *MFARepository) GetTOTP(ctx context.Context, userID int64) (*TOTPEnrollment, error) {
+	query := `
+		SELECT user_id, secret, created_at, confirmed_at, last_used_step
+		FROM users_totp
+		WHERE user_id = $1`
+
+	var enrollment TOTPEnrollment
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&enrollment.UserID,
+		&enrollment.Secret,
+		&enrollment.CreatedAt,
+		&enrollment.ConfirmedAt,
+		&enrollment.LastUsedStep,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &enrollment, nil
+}
+
+// StartTOTP stores a new unconfirmed secret for the user, replacing any earlier unconfirmed one. It returns
+// ErrMFAAlreadyEnrolled if the user already has a confirmed secret.
+func (r *MFARepository) StartTOTP(ctx context.Context, userID int64, secret []byte) error {
+	query := `
+		INSERT INTO users_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+		WHERE users_totp.confirmed_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrMFAAlreadyEnrolled
+	}
+
+	return nil
+}
+
+// ConfirmTOTP marks the user's enrollment as confirmed and replaces their recovery codes with the given hashes.
+func (r *MFARepository) ConfirmTOTP(ctx context.Context, userID, step int64, recoveryCodeHashes [][]byte) error {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE users_totp
+		SET confirmed_at = NOW(), last_used_step = $2
+		WHERE user_id = $1`, userID, step)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.ExecContext(ctx, `INSERT INTO recovery_codes (hash, user_id) VALUES ($1, $2)`, hash, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseTOTPStep records that the code for step has been used. It reports false if that step, or a later one, has
+// already been used, so that a code cannot be replayed.
+func (r *MFARepository) UseTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	query := `
+		UPDATE users_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// UseRecoveryCode marks the user's unused recovery code with the given hash as used, reporting whether one matched.
+func (r *MFARepository) UseRecoveryCode(ctx context.Context, userID int64, hash []byte) (bool, error) {
+	query := `
+		UPDATE recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, userID, hash)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/badrchoubai/services/internal/middleware"
+	"github.com/badrchoubai/services/internal/totp"
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const mfaPendingTokenTTL = 5 * time.Minute
+
+func (h *handler) startTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = h.mfa.StartTOTP(r.Context(), user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMFAAlreadyEnrolled):
+			h.errorResponse(w, r, http.StatusConflict, "multi-factor authentication is already enabled for this account")
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	h.encode(w, r, http.StatusCreated, envelope{
+		"secret":          totp.EncodeSecret(secret),
+		"provisioningUri": totp.ProvisioningURI(h.name, user.Email, secret),
+	})
+}
+
+func (h *handler) confirmTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if ValidateTOTPCode(v, input.Code); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+
+	enrollment, err := h.mfa.GetTOTP(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.notFoundResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if enrollment.Confirmed() {
+		h.errorResponse(w, r, http.StatusConflict, "multi-factor authentication is already enabled for this account")
+		return
+	}
+
+	step, ok := totp.Validate(enrollment.Secret, input.Code, time.Now())
+	if !ok {
+		v.AddError("code", "invalid code")
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	recoveryCodes, err := generateRecoveryCodes()
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	hashes := make([][]byte, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	if err := h.mfa.ConfirmTOTP(r.Context(), user.ID, step, hashes); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionMFAEnroll, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	h.encode(w, r, http.StatusOK, envelope{"recoveryCodes": recoveryCodes})
+}
+
+func (h *handler) createMFAAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken     string `json:"mfaToken"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	ValidateTokenPlaintext(v, input.MFAToken)
+
+	switch {
+	case input.Code != "":
+		ValidateTOTPCode(v, input.Code)
+	case input.RecoveryCode == "":
+		v.AddError("code", "either code or recoveryCode must be provided")
+	}
+
+	if !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := h.users.GetForToken(r.Context(), ScopeMFAPending, input.MFAToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.invalidCredentialsResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The pending token is good for a single attempt; a wrong code means starting over from the password, which
+	// keeps the six digit code space from being brute forced.
+	if err := h.tokens.DeleteAllForUser(r.Context(), ScopeMFAPending, user.ID); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	ok, err := h.verifySecondFactor(r, user.ID, input.Code, input.RecoveryCode)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !ok {
+		if err := h.recordFailedLogin(r, user.Email, user); err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+		h.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	if err := h.resetFailedLogins(r, user.Email); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tokens, err := h.issueTokenPair(r, user, nil, nil)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.auditLogin(r, user)
+
+	h.encode(w, r, http.StatusCreated, envelope{
+		"authenticationToken": tokens.AuthenticationToken,
+		"refreshToken":        tokens.RefreshToken,
+	})
+}
+
+// mfaRequired reports whether the user has confirmed TOTP enrollment and must present a second factor to log in.
+func (h *handler) mfaRequired(r *http.Request, userID int64) (bool, error) {
+	enrollment, err := h.mfa.GetTOTP(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return enrollment.Confirmed(), nil
+}
+
+// verifySecondFactor checks a TOTP code, or failing that a recovery code, for the user. Each code is accepted at most
+// once.
+func (h *handler) verifySecondFactor(r *http.Request, userID int64, code, recoveryCode string) (bool, error) {
+	if code == "" {
+		return h.mfa.UseRecoveryCode(r.Context(), userID, hashToken(normalizeRecoveryCode(recoveryCode)))
+	}
+
+	enrollment, err := h.mfa.GetTOTP(r.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := totp.Validate(enrollment.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	return h.mfa.UseTOTPStep(r.Context(), userID, step)
+}
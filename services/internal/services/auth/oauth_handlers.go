@@ -0,0 +1,662 @@
+package auth
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/tomasen/realip"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const (
+	authorizationCodeTTL = time.Minute
+	oauthAccessTokenTTL  = time.Hour
+)
+
+// oauthError is the error response body defined by RFC 6749 section 5.2. The OAuth2 endpoints use it in place of the
+// service's usual error envelope so that standard client libraries can interpret failures.
+type oauthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// oauthTokenResponse is the successful response body of the token endpoint.
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// introspectionResponse is the response body of the introspection endpoint defined by RFC 7662.
+type introspectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+}
+
+// authorizationParams are the parameters of an authorization request. The login page carries them through to its form
+// so that the request can be checked again when the user submits it.
+var authorizationParams = []string{
+	"client_id",
+	"redirect_uri",
+	"response_type",
+	"scope",
+	"state",
+	"code_challenge",
+	"code_challenge_method",
+	"nonce",
+}
+
+// authorizationRequest is a validated request to the authorization endpoint.
+type authorizationRequest struct {
+	client        *Client
+	redirectURI   string
+	state         string
+	scopes        []string
+	codeChallenge string
+	nonce         string
+	params        url.Values
+}
+
+// parseAuthorizationRequest validates the parameters of an authorization request. Errors are returned to the client
+// through its redirect URI once that is known to be registered, and shown to the user otherwise; either way a response
+// has been written when it returns false.
+func (h *handler) parseAuthorizationRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	params url.Values,
+) (*authorizationRequest, bool) {
+	client, err := h.clients.Get(r.Context(), params.Get("client_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "unknown client_id")
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	// Until the redirect URI is known to belong to the client, errors must not be sent to it.
+	redirectURI := params.Get("redirect_uri")
+	if !client.AllowsRedirectURI(redirectURI) {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "redirect_uri is not registered")
+		return nil, false
+	}
+
+	req := &authorizationRequest{
+		client:      client,
+		redirectURI: redirectURI,
+		state:       params.Get("state"),
+		params:      url.Values{},
+	}
+
+	for _, name := range authorizationParams {
+		req.params.Set(name, params.Get(name))
+	}
+
+	if params.Get("response_type") != "code" {
+		h.authorizationErrorRedirect(w, r, req, "unsupported_response_type", "response_type must be code")
+		return nil, false
+	}
+
+	if !client.AllowsGrant(GrantAuthorizationCode) {
+		h.authorizationErrorRedirect(w, r, req, "unauthorized_client", "client is not allowed the authorization_code grant")
+		return nil, false
+	}
+
+	req.codeChallenge = params.Get("code_challenge")
+	if params.Get("code_challenge_method") != codeChallengeMethodS256 || !pkceRX.MatchString(req.codeChallenge) {
+		h.authorizationErrorRedirect(
+			w,
+			r,
+			req,
+			"invalid_request",
+			"a code_challenge with code_challenge_method S256 is required",
+		)
+		return nil, false
+	}
+
+	scopes, ok := resolveScopes(params.Get("scope"), client.Scopes)
+	if !ok {
+		h.authorizationErrorRedirect(w, r, req, "invalid_scope", "requested scope is not allowed for this client")
+		return nil, false
+	}
+	req.scopes = scopes
+
+	req.nonce = params.Get("nonce")
+	if len(req.nonce) > 255 {
+		h.authorizationErrorRedirect(w, r, req, "invalid_request", "nonce must not be more than 255 bytes long")
+		return nil, false
+	}
+
+	return req, true
+}
+
+// authorizationErrorRedirect returns an error to the client that made an authorization request.
+func (h *handler) authorizationErrorRedirect(
+	w http.ResponseWriter,
+	r *http.Request,
+	req *authorizationRequest,
+	code, description string,
+) {
+	h.redirect(w, r, req.redirectURI, url.Values{
+		"error":             {code},
+		"error_description": {description},
+		"state":             {req.state},
+	})
+}
+
+// grantAuthorization issues an authorization code for the user and redirects back to the client with it.
+func (h *handler) grantAuthorization(w http.ResponseWriter, r *http.Request, req *authorizationRequest, user *User) {
+	code := &AuthorizationCode{
+		ClientID:      req.client.ID,
+		UserID:        user.ID,
+		RedirectURI:   req.redirectURI,
+		Scopes:        req.scopes,
+		CodeChallenge: req.codeChallenge,
+		Nonce:         req.nonce,
+	}
+
+	if err := h.codes.New(r.Context(), code, authorizationCodeTTL); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.redirect(w, r, req.redirectURI, url.Values{"code": {code.Plaintext}, "state": {req.state}})
+}
+
+// createOAuthToken implements the token endpoint, dispatching on grant_type once the client has authenticated.
+func (h *handler) createOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+
+	if !validator.PermittedValue(grantType, GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken) {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	if !client.AllowsGrant(grantType) {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "unauthorized_client", "")
+		return
+	}
+
+	switch grantType {
+	case GrantAuthorizationCode:
+		h.authorizationCodeGrant(w, r, client)
+	case GrantClientCredentials:
+		h.clientCredentialsGrant(w, r, client)
+	case GrantRefreshToken:
+		h.refreshTokenGrant(w, r, client)
+	}
+}
+
+func (h *handler) authorizationCodeGrant(w http.ResponseWriter, r *http.Request, client *Client) {
+	plaintext := r.PostForm.Get("code")
+	verifier := r.PostForm.Get("code_verifier")
+
+	if plaintext == "" || !pkceRX.MatchString(verifier) {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "code and code_verifier are required")
+		return
+	}
+
+	code, err := h.codes.Consume(r.Context(), plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if code.ClientID != client.ID ||
+		code.RedirectURI != r.PostForm.Get("redirect_uri") ||
+		!verifyCodeChallenge(code.CodeChallenge, verifier) {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "invalid or expired code")
+		return
+	}
+
+	user, ok := h.activeUserForGrant(w, r, code.UserID)
+	if !ok {
+		return
+	}
+
+	h.issueClientTokens(w, r, client, clientGrant{user: user, scopes: code.Scopes, nonce: code.Nonce})
+}
+
+func (h *handler) clientCredentialsGrant(w http.ResponseWriter, r *http.Request, client *Client) {
+	if client.Public() {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "unauthorized_client", "")
+		return
+	}
+
+	scopes, ok := resolveScopes(r.PostForm.Get("scope"), client.Scopes)
+	if !ok {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_scope", "")
+		return
+	}
+
+	h.issueClientTokens(w, r, client, clientGrant{scopes: scopes})
+}
+
+func (h *handler) refreshTokenGrant(w http.ResponseWriter, r *http.Request, client *Client) {
+	plaintext := r.PostForm.Get("refresh_token")
+	if plaintext == "" {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "refresh_token is required")
+		return
+	}
+
+	token, err := h.tokens.GetForClient(r.Context(), ScopeOAuthRefresh, plaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if token.ClientID != client.ID {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+		return
+	}
+
+	// Presenting a refresh token that was already rotated means it leaked, so the whole family is revoked.
+	reuseDetected := func() {
+		h.logger.Warn(
+			"refresh token reuse detected, revoking token family",
+			zap.Int64("userId", token.UserID),
+			zap.String("clientId", client.ID),
+			zap.String("family", hex.EncodeToString(token.Family)),
+		)
+
+		if err := h.tokens.DeleteFamily(r.Context(), token.Family); err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+	}
+
+	if token.Used {
+		reuseDetected()
+		return
+	}
+
+	// The rest of the request is checked before the token is claimed, so that a request failing for another reason
+	// leaves the token usable for a corrected retry rather than having that retry treated as reuse. A refresh may
+	// narrow the scope of the original grant but never widen it.
+	scopes, ok := resolveScopes(r.PostForm.Get("scope"), token.Scopes)
+	if !ok {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_scope", "")
+		return
+	}
+
+	user, ok := h.activeUserForGrant(w, r, token.UserID)
+	if !ok {
+		return
+	}
+
+	// Claiming the token and checking it was unused happen in one statement, so two concurrent refreshes with the
+	// same token cannot both succeed.
+	marked, err := h.tokens.MarkUsed(r.Context(), token.Hash)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !marked {
+		reuseDetected()
+		return
+	}
+
+	h.issueClientTokens(w, r, client, clientGrant{user: user, scopes: scopes, family: token.Family, parent: token.Hash})
+}
+
+// revokeOAuthToken implements token revocation as defined by RFC 7009. Revoking a refresh token revokes every token
+// issued from the same grant. Unknown tokens, and tokens belonging to other clients, are ignored, and the response
+// is always 200 so that it reveals nothing about the token.
+func (h *handler) revokeOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	plaintext := r.PostForm.Get("token")
+	if plaintext == "" {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	token, err := h.lookupClientToken(r, plaintext)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if token != nil && token.ClientID == client.ID {
+		if token.Scope == ScopeOAuthRefresh && token.Family != nil {
+			err = h.tokens.DeleteFamily(r.Context(), token.Family)
+		} else {
+			err = h.tokens.Delete(r.Context(), token.Hash)
+		}
+
+		if err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// introspectOAuthToken implements token introspection as defined by RFC 7662, for resource servers registered as
+// confidential clients.
+func (h *handler) introspectOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	client, ok := h.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	if client.Public() {
+		h.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "introspection requires a client secret")
+		return
+	}
+
+	plaintext := r.PostForm.Get("token")
+	if plaintext == "" {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	token, err := h.lookupClientToken(r, plaintext)
+	if err != nil && !errors.Is(err, ErrRecordNotFound) {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := introspectionResponse{Active: false}
+
+	if token != nil && !token.Used {
+		response = introspectionResponse{
+			Active:    true,
+			Scope:     strings.Join(token.Scopes, " "),
+			ClientID:  token.ClientID,
+			ExpiresAt: token.Expiry.Unix(),
+			IssuedAt:  token.CreatedAt.Unix(),
+			Issuer:    h.config.OIDCIssuer(),
+		}
+
+		if token.UserID != 0 {
+			response.Subject = strconv.FormatInt(token.UserID, 10)
+		}
+
+		if token.Scope == ScopeOAuthAccess {
+			response.TokenType = "Bearer"
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := h.encoderDecoder.EncodeResponse(w, http.StatusOK, response); err != nil {
+		h.logError(r, err)
+	}
+}
+
+// authenticateClient identifies the client from HTTP Basic credentials or, failing that, the client_id and
+// client_secret form parameters. Public clients identify themselves with client_id alone. It writes an
+// invalid_client error and returns false if the client cannot be authenticated.
+func (h *handler) authenticateClient(w http.ResponseWriter, r *http.Request) (*Client, bool) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		// RFC 6749 section 2.3.1 form-encodes the credentials before they are placed in the header.
+		var errID, errSecret error
+		id, errID = url.QueryUnescape(id)
+		secret, errSecret = url.QueryUnescape(secret)
+		if errID != nil || errSecret != nil {
+			h.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "")
+			return nil, false
+		}
+	} else {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if id == "" {
+		h.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "")
+		return nil, false
+	}
+
+	client, err := h.clients.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "")
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	authenticated := client.SecretMatches(secret)
+	if client.Public() {
+		authenticated = secret == ""
+	}
+
+	if !authenticated {
+		h.oauthErrorResponse(w, r, http.StatusUnauthorized, "invalid_client", "")
+		return nil, false
+	}
+
+	return client, true
+}
+
+// activeUserForGrant loads the user a grant was issued to, writing an invalid_grant error and returning false if the
+// account no longer exists or has been deactivated.
+func (h *handler) activeUserForGrant(w http.ResponseWriter, r *http.Request, userID int64) (*User, bool) {
+	user, err := h.users.Get(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "")
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !user.Activated {
+		h.oauthErrorResponse(w, r, http.StatusBadRequest, "invalid_grant", "")
+		return nil, false
+	}
+
+	return user, true
+}
+
+// clientGrant describes the tokens to issue to a client. A nil user issues a token for the client alone; family and
+// parent are set when rotating a refresh token.
+type clientGrant struct {
+	user   *User
+	scopes []string
+	nonce  string
+	family []byte
+	parent []byte
+}
+
+// issueClientTokens issues an access token to the client and, for grants made on behalf of a user, a refresh token in
+// the same family if the client may refresh, and an ID token if the openid scope was granted.
+func (h *handler) issueClientTokens(w http.ResponseWriter, r *http.Request, client *Client, grant clientGrant) {
+	family := grant.family
+	if family == nil {
+		var err error
+		if family, err = newTokenFamily(); err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	var userID int64
+	if grant.user != nil {
+		userID = grant.user.ID
+	}
+
+	accessToken, err := h.newClientToken(
+		r,
+		client,
+		userID,
+		oauthAccessTokenTTL,
+		ScopeOAuthAccess,
+		grant.scopes,
+		family,
+		nil,
+	)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	response := oauthTokenResponse{
+		AccessToken: accessToken.Plaintext,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(oauthAccessTokenTTL.Seconds()),
+		Scope:       strings.Join(grant.scopes, " "),
+	}
+
+	if grant.user != nil && client.AllowsGrant(GrantRefreshToken) {
+		refreshToken, err := h.newClientToken(
+			r,
+			client,
+			userID,
+			refreshTokenTTL,
+			ScopeOAuthRefresh,
+			grant.scopes,
+			family,
+			grant.parent,
+		)
+		if err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+
+		response.RefreshToken = refreshToken.Plaintext
+	}
+
+	if grant.user != nil && slices.Contains(grant.scopes, oidcScopeOpenID) {
+		response.IDToken, err = h.newIDToken(client, grant.user, grant.scopes, grant.nonce)
+		if err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := h.encoderDecoder.EncodeResponse(w, http.StatusOK, response); err != nil {
+		h.logError(r, err)
+	}
+}
+
+// newClientToken generates and stores a token issued to an OAuth2 client.
+func (h *handler) newClientToken(
+	r *http.Request,
+	client *Client,
+	userID int64,
+	ttl time.Duration,
+	scope string,
+	scopes []string,
+	family, parent []byte,
+) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Family = family
+	token.Parent = parent
+	token.IP = realip.FromRequest(r)
+	token.UserAgent = r.UserAgent()
+	token.ClientID = client.ID
+	token.Scopes = scopes
+
+	err = h.tokens.Insert(r.Context(), token)
+	return token, err
+}
+
+// lookupClientToken finds an OAuth2 access or refresh token by its plaintext.
+func (h *handler) lookupClientToken(r *http.Request, plaintext string) (*Token, error) {
+	token, err := h.tokens.GetForClient(r.Context(), ScopeOAuthAccess, plaintext)
+	if errors.Is(err, ErrRecordNotFound) {
+		token, err = h.tokens.GetForClient(r.Context(), ScopeOAuthRefresh, plaintext)
+	}
+
+	return token, err
+}
+
+// redirect sends the user agent to uri with params merged into its query, dropping empty values.
+func (h *handler) redirect(w http.ResponseWriter, r *http.Request, uri string, params url.Values) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		if values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (h *handler) oauthErrorResponse(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="`+h.name+`"`)
+	}
+
+	if err := h.encoderDecoder.EncodeResponse(w, status, oauthError{Error: code, Description: description}); err != nil {
+		h.logError(r, err)
+	}
+}
@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/badrchoubai/services/internal/jwt"
+)
+
+const testRedirectURI = "https://app.example.com/callback"
+
+// newAuthorizationParams returns the parameters of an authorization request from the client, along with the PKCE
+// verifier the code must be redeemed with.
+func newAuthorizationParams(t *testing.T, client *Client) (url.Values, string) {
+	t.Helper()
+
+	verifier, err := randomString(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := url.Values{
+		"client_id":             {client.ID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {"openid email"},
+		"state":                 {"af0ifjsldkj"},
+		"code_challenge":        {codeChallengeS256(verifier)},
+		"code_challenge_method": {codeChallengeMethodS256},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+	}
+
+	return params, verifier
+}
+
+// submitAuthorization posts the login and consent form for the authorization request, returning the response without
+// following any redirect.
+func (ts *testServer) submitAuthorization(t *testing.T, params url.Values, fields map[string]string) *http.Response {
+	t.Helper()
+
+	form := maps.Clone(params)
+	for name, value := range fields {
+		form.Set(name, value)
+	}
+
+	resp, err := ts.noRedirectClient().PostForm(ts.URL+"/oauth2/authorize", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	return resp
+}
+
+// redirectParams returns the query of the redirect back to the client.
+func redirectParams(t *testing.T, resp *http.Response) url.Values {
+	t.Helper()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("got status %d, want a redirect", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if location.Scheme+"://"+location.Host+location.Path != testRedirectURI {
+		t.Fatalf("redirected to %s, want %s", location, testRedirectURI)
+	}
+
+	return location.Query()
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	userID := ts.createActivatedUser(t, "Alice", testEmail, testPassword)
+
+	client := &Client{
+		Name:         "App",
+		RedirectURIs: []string{testRedirectURI},
+		GrantTypes:   []string{GrantAuthorizationCode, GrantRefreshToken},
+		Scopes:       []string{oidcScopeOpenID, oidcScopeEmail},
+	}
+	secret := ts.createClient(t, client, false)
+
+	params, verifier := newAuthorizationParams(t, client)
+
+	// A browser following the client's redirect carries no credentials and is shown the login page.
+	resp, err := ts.Client().Get(ts.URL + "/oauth2/authorize?" + params.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Fatalf("got status %d with %s, want the login page", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	if !strings.Contains(string(page), `name="code_challenge" value="`+params.Get("code_challenge")+`"`) {
+		t.Fatal("login page does not carry the authorization request")
+	}
+
+	redirect := redirectParams(t, ts.submitAuthorization(t, params, map[string]string{
+		"email":    testEmail,
+		"password": testPassword,
+		"decision": "allow",
+	}))
+
+	if redirect.Get("state") != params.Get("state") {
+		t.Fatalf("got state %q, want %q", redirect.Get("state"), params.Get("state"))
+	}
+
+	code := redirect.Get("code")
+	if code == "" {
+		t.Fatalf("no code in redirect: %v", redirect)
+	}
+
+	exchange := url.Values{
+		"grant_type":    {GrantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	}
+
+	var tokens oauthTokenResponse
+	if status := ts.postForm(t, "/oauth2/token", exchange, client.ID, secret, &tokens); status != http.StatusOK {
+		t.Fatalf("exchanging code: got status %d", status)
+	}
+
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.IDToken == "" {
+		t.Fatalf("got %+v, want access, refresh and ID tokens", tokens)
+	}
+
+	// The ID token verifies against the published keys and identifies the user to this client.
+	resp, err = ts.Client().Get(ts.URL + "/.well-known/jwks.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := jwt.ParseJWKS(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims IDClaims
+	if err := keys.Verify(tokens.IDToken, &claims); err != nil {
+		t.Fatalf("verifying ID token: %v", err)
+	}
+
+	if claims.Subject != strconv.FormatInt(userID, 10) ||
+		!claims.Audience.Contains(client.ID) ||
+		claims.Nonce != params.Get("nonce") ||
+		claims.Email != testEmail {
+		t.Fatalf("got ID token claims %+v", claims)
+	}
+
+	// Codes are single use.
+	var oauthErr oauthError
+	if status := ts.postForm(t, "/oauth2/token", exchange, client.ID, secret, &oauthErr); status != http.StatusBadRequest {
+		t.Fatalf("redeeming code twice: got status %d", status)
+	}
+
+	if oauthErr.Error != "invalid_grant" {
+		t.Fatalf("redeeming code twice: got error %q", oauthErr.Error)
+	}
+
+	var info map[string]any
+	if status := ts.do(t, http.MethodGet, "/oauth2/userinfo", tokens.AccessToken, nil, &info); status != http.StatusOK {
+		t.Fatalf("fetching userinfo: got status %d", status)
+	}
+
+	if info["sub"] != strconv.FormatInt(userID, 10) || info["email"] != testEmail {
+		t.Fatalf("got userinfo %v", info)
+	}
+
+	refresh := url.Values{"grant_type": {GrantRefreshToken}, "refresh_token": {tokens.RefreshToken}}
+
+	var refreshed oauthTokenResponse
+	if status := ts.postForm(t, "/oauth2/token", refresh, client.ID, secret, &refreshed); status != http.StatusOK {
+		t.Fatalf("refreshing: got status %d", status)
+	}
+
+	if refreshed.AccessToken == "" || refreshed.RefreshToken == "" || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Fatalf("refreshing: got %+v, want a new token pair", refreshed)
+	}
+
+	var introspection introspectionResponse
+	status := ts.postForm(
+		t,
+		"/oauth2/introspect",
+		url.Values{"token": {refreshed.AccessToken}},
+		client.ID,
+		secret,
+		&introspection,
+	)
+	if status != http.StatusOK {
+		t.Fatalf("introspecting: got status %d", status)
+	}
+
+	if !introspection.Active ||
+		introspection.Subject != strconv.FormatInt(userID, 10) ||
+		introspection.ClientID != client.ID ||
+		introspection.Scope != "openid email" ||
+		introspection.TokenType != "Bearer" {
+		t.Fatalf("got introspection %+v", introspection)
+	}
+
+	// Revoking the refresh token revokes its whole family, taking the access token issued with it along.
+	revoke := url.Values{"token": {refreshed.RefreshToken}}
+	if status := ts.postForm(t, "/oauth2/revoke", revoke, client.ID, secret, nil); status != http.StatusOK {
+		t.Fatalf("revoking: got status %d", status)
+	}
+
+	introspection = introspectionResponse{}
+	status = ts.postForm(
+		t,
+		"/oauth2/introspect",
+		url.Values{"token": {refreshed.AccessToken}},
+		client.ID,
+		secret,
+		&introspection,
+	)
+	if status != http.StatusOK || introspection.Active {
+		t.Fatalf("introspecting revoked token: got status %d and %+v", status, introspection)
+	}
+
+	refresh.Set("refresh_token", refreshed.RefreshToken)
+	if status := ts.postForm(t, "/oauth2/token", refresh, client.ID, secret, nil); status != http.StatusBadRequest {
+		t.Fatalf("refreshing with a revoked token: got status %d", status)
+	}
+}
+
+func TestAuthorizationLoginAndConsent(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	ts.createActivatedUser(t, "Alice", testEmail, testPassword)
+
+	client := &Client{
+		Name:         "App",
+		RedirectURIs: []string{testRedirectURI},
+		GrantTypes:   []string{GrantAuthorizationCode},
+		Scopes:       []string{oidcScopeOpenID},
+	}
+	ts.createClient(t, client, true)
+
+	params, _ := newAuthorizationParams(t, client)
+	params.Set("scope", oidcScopeOpenID)
+
+	t.Run("wrong password", func(t *testing.T) {
+		resp := ts.submitAuthorization(t, params, map[string]string{
+			"email":    testEmail,
+			"password": "not-the-password",
+			"decision": "allow",
+		})
+
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("Location") != "" {
+			t.Fatalf("got status %d, want the login page again", resp.StatusCode)
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		redirect := redirectParams(t, ts.submitAuthorization(t, params, map[string]string{"decision": "deny"}))
+
+		if redirect.Get("error") != "access_denied" || redirect.Get("code") != "" {
+			t.Fatalf("got redirect %v, want access_denied", redirect)
+		}
+	})
+
+	t.Run("prompt none", func(t *testing.T) {
+		query := maps.Clone(params)
+		query.Set("prompt", "none")
+
+		resp, err := ts.noRedirectClient().Get(ts.URL + "/oauth2/authorize?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+
+		if redirect := redirectParams(t, resp); redirect.Get("error") != "login_required" {
+			t.Fatalf("got redirect %v, want login_required", redirect)
+		}
+	})
+
+	t.Run("unregistered redirect uri", func(t *testing.T) {
+		query := maps.Clone(params)
+		query.Set("redirect_uri", "https://attacker.example.com/callback")
+
+		resp, err := ts.noRedirectClient().Get(ts.URL + "/oauth2/authorize?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("got status %d, want the error shown rather than redirected", resp.StatusCode)
+		}
+	})
+}
+
+func TestClientCredentialsGrant(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	client := &Client{
+		Name:       "Reporting",
+		GrantTypes: []string{GrantClientCredentials},
+		Scopes:     []string{"reports:read", "reports:write"},
+	}
+	secret := ts.createClient(t, client, false)
+
+	grant := url.Values{"grant_type": {GrantClientCredentials}, "scope": {"reports:read"}}
+
+	var tokens oauthTokenResponse
+	if status := ts.postForm(t, "/oauth2/token", grant, client.ID, secret, &tokens); status != http.StatusOK {
+		t.Fatalf("got status %d", status)
+	}
+
+	if tokens.AccessToken == "" || tokens.RefreshToken != "" || tokens.IDToken != "" || tokens.Scope != "reports:read" {
+		t.Fatalf("got %+v, want only an access token for reports:read", tokens)
+	}
+
+	var introspection introspectionResponse
+	status := ts.postForm(
+		t,
+		"/oauth2/introspect",
+		url.Values{"token": {tokens.AccessToken}},
+		client.ID,
+		secret,
+		&introspection,
+	)
+	if status != http.StatusOK {
+		t.Fatalf("introspecting: got status %d", status)
+	}
+
+	if !introspection.Active || introspection.ClientID != client.ID || introspection.Subject != "" {
+		t.Fatalf("got introspection %+v", introspection)
+	}
+
+	// The token acts for the client alone, so it is no good as a user's bearer token.
+	if status := ts.do(t, http.MethodGet, "/users/me", tokens.AccessToken, nil, nil); status != http.StatusUnauthorized {
+		t.Fatalf("using the token as a user: got status %d", status)
+	}
+
+	status = ts.postForm(t, "/oauth2/token", grant, client.ID, "wrong-secret", nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("wrong secret: got status %d", status)
+	}
+
+	grant.Set("scope", "users:write")
+	if status := ts.postForm(t, "/oauth2/token", grant, client.ID, secret, nil); status != http.StatusBadRequest {
+		t.Fatalf("unregistered scope: got status %d", status)
+	}
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/badrchoubai/services/internal/jwt"
+	"github.com/badrchoubai/services/internal/middleware"
+)
+
+const (
+	// oidcScopeOpenID marks an OAuth2 request as an OpenID Connect request, causing an ID token to be issued.
+	oidcScopeOpenID = "openid"
+
+	// oidcScopeProfile releases the name claim.
+	oidcScopeProfile = "profile"
+
+	// oidcScopeEmail releases the email and email_verified claims.
+	oidcScopeEmail = "email"
+
+	idTokenTTL = time.Hour
+)
+
+// userClaims are the standard OpenID Connect claims about a user, each released only if its scope was granted.
+type userClaims struct {
+	Name          string `json:"name,omitempty"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+}
+
+// IDClaims are the claims of an OpenID Connect ID token.
+type IDClaims struct {
+	jwt.RegisteredClaims
+	userClaims
+
+	Nonce           string `json:"nonce,omitempty"`
+	AuthorizedParty string `json:"azp,omitempty"`
+}
+
+// userInfo is the response body of the userinfo endpoint.
+type userInfo struct {
+	Subject string `json:"sub"`
+	userClaims
+}
+
+// discoveryDocument is the OpenID Provider metadata defined by OpenID Connect Discovery 1.0. The authorization
+// endpoint is meant for the user's browser: it shows a login and consent page rather than expecting a bearer token.
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ResponseModesSupported            []string `json:"response_modes_supported"`
+	PromptValuesSupported             []string `json:"prompt_values_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// releaseClaims returns the claims about a user permitted by the granted scopes. The account's activated flag stands
+// in for email_verified, since activation proves control of the address.
+func releaseClaims(name, email string, activated bool, scopes []string) userClaims {
+	var claims userClaims
+
+	if slices.Contains(scopes, oidcScopeProfile) {
+		claims.Name = name
+	}
+
+	if slices.Contains(scopes, oidcScopeEmail) {
+		claims.Email = email
+		claims.EmailVerified = &activated
+	}
+
+	return claims
+}
+
+// newIDToken signs an ID token asserting the user's identity to the client.
+func (h *handler) newIDToken(client *Client, user *User, scopes []string, nonce string) (string, error) {
+	now := time.Now()
+
+	claims := IDClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    h.config.OIDCIssuer(),
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Audience:  jwt.Audience{client.ID},
+			ExpiresAt: now.Add(idTokenTTL).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		userClaims:      releaseClaims(user.Name, user.Email, user.Activated, scopes),
+		Nonce:           nonce,
+		AuthorizedParty: client.ID,
+	}
+
+	return h.keys.Sign(claims)
+}
+
+func (h *handler) showOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	issuer := h.config.OIDCIssuer()
+
+	document := discoveryDocument{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth2/authorize",
+		TokenEndpoint:                     issuer + "/oauth2/token",
+		UserInfoEndpoint:                  issuer + "/oauth2/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		RevocationEndpoint:                issuer + "/oauth2/revoke",
+		IntrospectionEndpoint:             issuer + "/oauth2/introspect",
+		ScopesSupported:                   []string{oidcScopeOpenID, oidcScopeProfile, oidcScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		ResponseModesSupported:            []string{"query"},
+		PromptValuesSupported:             []string{"none", "login", "consent"},
+		GrantTypesSupported:               []string{GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  h.keys.Algorithms(),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{codeChallengeMethodS256},
+		ClaimsSupported: []string{
+			"sub", "iss", "aud", "exp", "iat", "nonce", "azp", "name", "email", "email_verified",
+		},
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	if err := h.encoderDecoder.EncodeResponse(w, http.StatusOK, document); err != nil {
+		h.logError(r, err)
+	}
+}
+
+func (h *handler) showUserInfo(w http.ResponseWriter, r *http.Request) {
+	user := middleware.ContextGetUser(r)
+
+	info := userInfo{
+		Subject:    strconv.FormatInt(user.ID, 10),
+		userClaims: releaseClaims(user.Name, user.Email, user.Activated, user.Scopes),
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := h.encoderDecoder.EncodeResponse(w, http.StatusOK, info); err != nil {
+		h.logError(r, err)
+	}
+}
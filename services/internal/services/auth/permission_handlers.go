@@ -0,0 +1,124 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+func (h *handler) listUserPermissions(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	permissions, err := h.permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.encode(w, r, http.StatusOK, envelope{"permissions": permissions})
+}
+
+func (h *handler) grantUserPermissions(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Codes []string `json:"codes"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if ValidatePermissionCodes(v, input.Codes); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.permissions.AddForUser(r.Context(), user.ID, input.Codes...); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{
+		Action:   AuditActionPermissionGrant,
+		TargetID: &user.ID,
+		Target:   strings.Join(input.Codes, " "),
+		Outcome:  AuditOutcomeSuccess,
+	})
+
+	permissions, err := h.permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.encode(w, r, http.StatusOK, envelope{"permissions": permissions})
+}
+
+func (h *handler) revokeUserPermission(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+
+	v := validator.New()
+	if ValidatePermissionCodes(v, []string{code}); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, ok := h.userFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.permissions.RemoveForUser(r.Context(), user.ID, code); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{
+		Action:   AuditActionPermissionRevoke,
+		TargetID: &user.ID,
+		Target:   code,
+		Outcome:  AuditOutcomeSuccess,
+	})
+
+	permissions, err := h.permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.encode(w, r, http.StatusOK, envelope{"permissions": permissions})
+}
+
+// userFromPath loads the user identified by the {id} path parameter, writing a 404 and returning false when the
+// parameter is malformed or no such user exists.
+func (h *handler) userFromPath(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	id, err := readIDParam(r)
+	if err != nil {
+		h.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := h.users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.notFoundResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"github.com/lib/pq"
+	"regexp"
+	"slices"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const (
+	// PermissionAuditRead allows reading the audit log.
+	PermissionAuditRead = "audit:read"
+
+	// PermissionClientsWrite allows registering and deleting OAuth2 clients.
+	PermissionClientsWrite = "clients:write"
+
+	// PermissionUsersRead allows reading other users' accounts.
+	PermissionUsersRead = "users:read"
+
+	// PermissionUsersWrite allows modifying other users' accounts.
+	PermissionUsersWrite = "users:write"
+)
+
+// permissionCodeRX matches permission codes of the form <resource>:<action>.
+var permissionCodeRX = regexp.MustCompile(`^[a-z-]+:[a-z-]+$`)
+
+// Permissions is the set of permission codes held by a user.
+type Permissions []string
+
+// Include reports whether the set contains the given permission code.
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+// ValidatePermissionCodes checks that at least one code is provided and that each code is well-formed.
+func ValidatePermissionCodes(v *validator.Validator, codes []string) {
+	v.Check(len(codes) > 0, "codes", "must contain at least one entry")
+
+	for _, code := range codes {
+		v.Check(validator.Matches(code, permissionCodeRX), "codes", "must contain only <resource>:<action> codes")
+	}
+}
+
+// PermissionRepository provides access to the permissions and users_permissions tables.
+type PermissionRepository struct {
+	db *sql.DB
+}
+
+// NewPermissionRepository returns a PermissionRepository backed by the given database handle.
+func NewPermissionRepository(db *sql.DB) *PermissionRepository {
+	return &PermissionRepository{db: db}
+}
+
+// GetAllForUser returns every permission code granted to the user.
+func (r *PermissionRepository) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	query := `
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+		WHERE users_permissions.user_id = $1
+		ORDER BY permissions.code`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var permission string
+
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, permission)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// AddForUser grants the given permission codes to the user. Codes the user already holds and codes that do not
+// exist in the permissions table are ignored.
+func (r *PermissionRepository) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `
+		INSERT INTO users_permissions (user_id, permission_id)
+		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
+
+// RemoveForUser revokes the given permission codes from the user.
+func (r *PermissionRepository) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `
+		DELETE FROM users_permissions
+		USING permissions
+		WHERE users_permissions.permission_id = permissions.id
+		AND users_permissions.user_id = $1
+		AND permissions.code = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, userID, pq.Array(codes))
+	return err
+}
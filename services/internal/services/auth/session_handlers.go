@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/badrchoubai/services/internal/middleware"
+)
+
+// Session describes an active login as shown to the user it belongs to: the access and refresh tokens descended from
+// it, which share a token family. It never exposes the tokens, their hashes or the family.
+type Session struct {
+	family []byte
+
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"userAgent"`
+	Current    bool       `json:"current"`
+}
+
+func (h *handler) listSessions(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	sessions, err := h.sessionsForUser(r, middleware.ContextGetUser(r).ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.encode(w, r, http.StatusOK, envelope{"sessions": sessions})
+}
+
+// sessionsForUser returns the user's active sessions, marking the one the request was made with as current.
+func (h *handler) sessionsForUser(r *http.Request, userID int64) ([]*Session, error) {
+	sessions, err := h.tokens.GetSessionsForUser(r.Context(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	current, _, err := h.currentSession(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = current != nil && bytes.Equal(session.family, current)
+	}
+
+	return sessions, nil
+}
+
+func (h *handler) deleteCurrentToken(w http.ResponseWriter, r *http.Request) {
+	family, hash, err := h.currentSession(r)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Requests authenticated with an API key, or with a token whose session has already ended, have no session to
+	// log out of.
+	if family == nil && hash == nil {
+		h.errorResponse(w, r, http.StatusNotFound, "the request was not made with a session token")
+		return
+	}
+
+	// Revoking the whole family logs the session out, taking the refresh token issued alongside it with it.
+	if family != nil {
+		err = h.tokens.DeleteFamily(r.Context(), family)
+	} else {
+		err = h.tokens.Delete(r.Context(), hash)
+	}
+
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+	h.audit(r, &AuditEvent{Action: AuditActionLogout, TargetID: &user.ID, Outcome: AuditOutcomeSuccess})
+
+	// A JWT cannot be revoked, only the refresh tokens that would renew it, so it is honoured until it expires.
+	message := "the current session has been logged out"
+	if hash == nil {
+		message = "the current session's refresh tokens have been revoked; its access token remains valid until it expires"
+	}
+
+	h.encode(w, r, http.StatusOK, envelope{"message": message})
+}
+
+func (h *handler) deleteAllTokens(w http.ResponseWriter, r *http.Request) {
+	if !h.requireInteractiveUser(w, r) {
+		return
+	}
+
+	user := middleware.ContextGetUser(r)
+
+	if err := h.tokens.DeleteAllScopesForUser(r.Context(), user.ID); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{Action: AuditActionLogout, TargetID: &user.ID, Target: "all", Outcome: AuditOutcomeSuccess})
+
+	h.encode(w, r, http.StatusOK, envelope{"message": "all sessions have been logged out"})
+}
+
+// currentSession resolves the bearer token the request was authenticated with to its token family and, for opaque
+// tokens, its hash. JWTs cannot be revoked themselves, so only the family named by their sid claim is returned.
+func (h *handler) currentSession(r *http.Request) (family, hash []byte, err error) {
+	plaintext := middleware.ContextGetToken(r)
+
+	var claims middleware.AccessClaims
+	if err := h.keys.Verify(plaintext, &claims); err == nil {
+		if claims.SessionID == "" {
+			return nil, nil, nil
+		}
+
+		family, err := hex.DecodeString(claims.SessionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		return family, nil, nil
+	}
+
+	token, err := h.tokens.Get(r.Context(), ScopeAuthentication, plaintext)
+	if err != nil {
+		if errors.Is(err, ErrRecordNotFound) {
+			return nil, nil, nil
+		}
+		return nil, nil, err
+	}
+
+	return token.Family, token.Hash, nil
+}
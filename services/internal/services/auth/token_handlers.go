@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"encoding/hex"
+	"errors"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const (
+	authenticationTokenTTL = 24 * time.Hour
+	passwordResetTokenTTL  = 45 * time.Minute
+	refreshTokenTTL        = 30 * 24 * time.Hour
+)
+
+func (h *handler) createAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	ValidateEmail(v, input.Email)
+	ValidatePasswordPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Throttling applies whether or not the account exists, so a 429 reveals nothing about registered addresses.
+	retryAfter, err := h.loginRetryAfter(r, input.Email)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if retryAfter > 0 {
+		h.tooManyLoginAttemptsResponse(w, r, retryAfter)
+		return
+	}
+
+	user, err := h.users.GetByEmail(r.Context(), input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			// Unknown emails cost the same hashing work as known ones, so they cannot be told apart by timing.
+			if err := h.hasher.VerifyDummy(input.Password); err != nil {
+				h.serverErrorResponse(w, r, err)
+				return
+			}
+			if err := h.recordFailedLogin(r, input.Email, nil); err != nil {
+				h.serverErrorResponse(w, r, err)
+				return
+			}
+			h.invalidCredentialsResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	match, rehash, err := user.Password.Matches(h.hasher, input.Password)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		if err := h.recordFailedLogin(r, input.Email, user); err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+		h.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	if rehash {
+		h.rehashPassword(r, user, input.Password)
+	}
+
+	// Only reveal the activation state once the caller has proven they own the account.
+	if !user.Activated {
+		h.inactiveAccountResponse(w, r)
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// completeLogin responds to a successful first-factor login, either by challenging the user for a second factor or
+// by issuing a new token pair.
+func (h *handler) completeLogin(w http.ResponseWriter, r *http.Request, user *User) {
+	mfaRequired, err := h.mfaRequired(r, user.ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if mfaRequired {
+		token, err := h.tokens.New(r.Context(), user.ID, mfaPendingTokenTTL, ScopeMFAPending)
+		if err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+
+		h.encode(w, r, http.StatusAccepted, envelope{"mfaRequired": true, "mfaToken": token})
+		return
+	}
+
+	if err := h.resetFailedLogins(r, user.Email); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tokens, err := h.issueTokenPair(r, user, nil, nil)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.auditLogin(r, user)
+
+	h.encode(w, r, http.StatusCreated, envelope{
+		"authenticationToken": tokens.AuthenticationToken,
+		"refreshToken":        tokens.RefreshToken,
+	})
+}
+
+// rehashPassword upgrades a user's password hash to the preferred algorithm and parameters using the plaintext they
+// just logged in with. A failure is only logged, since the old hash still works and the next login will try again.
+func (h *handler) rehashPassword(r *http.Request, user *User, plaintext string) {
+	previous := user.Password.hash
+
+	if err := user.Password.Set(h.hasher, plaintext); err != nil {
+		h.logError(r, err)
+		return
+	}
+
+	if err := h.users.UpdatePasswordHash(r.Context(), user, previous); err != nil && !errors.Is(err, ErrEditConflict) {
+		h.logError(r, err)
+	}
+}
+
+func (h *handler) refreshAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"refreshToken"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := h.tokens.Get(r.Context(), ScopeRefresh, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.invalidRefreshTokenResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Claiming the token and checking it was unused happen in one statement, so two concurrent refreshes with the
+	// same token cannot both succeed.
+	claimed := false
+	if !token.Used {
+		claimed, err = h.tokens.MarkUsed(r.Context(), token.Hash)
+		if err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if !claimed {
+		h.logger.Warn(
+			"refresh token reuse detected, revoking token family",
+			zap.Int64("userId", token.UserID),
+			zap.String("family", hex.EncodeToString(token.Family)),
+		)
+
+		if err := h.tokens.DeleteFamily(r.Context(), token.Family); err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+
+		h.invalidRefreshTokenResponse(w, r)
+		return
+	}
+
+	user, err := h.users.Get(r.Context(), token.UserID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !user.Activated {
+		h.inactiveAccountResponse(w, r)
+		return
+	}
+
+	tokens, err := h.issueTokenPair(r, user, token.Family, token.Hash)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.encode(w, r, http.StatusCreated, envelope{
+		"authenticationToken": tokens.AuthenticationToken,
+		"refreshToken":        tokens.RefreshToken,
+	})
+}
+
+func (h *handler) createPasswordResetToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if ValidateEmail(v, input.Email); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The response is the same whether or not the email belongs to an activated account, so that this endpoint
+	// cannot be used to discover registered addresses.
+	message := "an email will be sent to you containing password reset instructions"
+
+	user, err := h.users.GetByEmail(r.Context(), input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.encode(w, r, http.StatusAccepted, envelope{"message": message})
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !user.Activated {
+		h.encode(w, r, http.StatusAccepted, envelope{"message": message})
+		return
+	}
+
+	token, err := h.tokens.New(r.Context(), user.ID, passwordResetTokenTTL, ScopePasswordReset)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.sendEmail(user.Email, "password_reset.tmpl", map[string]any{
+		"Name":               user.Name,
+		"ResetPath":          h.path + "/users/password",
+		"PasswordResetToken": token.Plaintext,
+	})
+
+	h.audit(r, &AuditEvent{
+		Action:   AuditActionPasswordResetRequest,
+		TargetID: &user.ID,
+		Target:   user.Email,
+		Outcome:  AuditOutcomeSuccess,
+	})
+
+	h.encode(w, r, http.StatusAccepted, envelope{"message": message})
+}
@@ -0,0 +1,430 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+
+	"github.com/badrchoubai/services/internal/middleware"
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const (
+	// ScopeActivation is the scope of tokens used to activate a newly registered account.
+	ScopeActivation = "activation"
+
+	// ScopeAuthentication is the scope of bearer tokens issued on login.
+	ScopeAuthentication = "authentication"
+
+	// ScopeEmailChange is the scope of tokens used to confirm a change of an account's email address.
+	ScopeEmailChange = "email-change"
+
+	// ScopePasswordReset is the scope of tokens used to set a new password for an account.
+	ScopePasswordReset = "password-reset"
+
+	// ScopeRefresh is the scope of long-lived tokens exchanged for new access tokens.
+	ScopeRefresh = "refresh"
+
+	// ScopeOAuthAccess is the scope of access tokens issued to OAuth2 clients.
+	ScopeOAuthAccess = "oauth-access"
+
+	// ScopeOAuthRefresh is the scope of refresh tokens issued to OAuth2 clients.
+	ScopeOAuthRefresh = "oauth-refresh"
+)
+
+// tokenPlaintextLength is the length of the plaintext tokens generateToken produces.
+const tokenPlaintextLength = 26
+
+// Token is a high-entropy secret issued to a user for a single scope. Only the SHA-256 hash of the plaintext is
+// persisted; the plaintext is handed to the user once and never stored.
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+
+	// Family groups every token issued from a single login, so that a whole session can be revoked at once. Parent
+	// is the hash of the refresh token this token was rotated from, and Used marks a refresh token as spent.
+	Family []byte `json:"-"`
+	Parent []byte `json:"-"`
+	Used   bool   `json:"-"`
+
+	// Metadata about the client a token was issued to, recorded for session listings.
+	CreatedAt  time.Time  `json:"-"`
+	LastUsedAt *time.Time `json:"-"`
+	IP         string     `json:"-"`
+	UserAgent  string     `json:"-"`
+
+	// ClientID and Scopes are set on tokens issued to OAuth2 clients. Tokens from the client credentials grant act for
+	// the client alone and have a zero UserID.
+	ClientID string   `json:"-"`
+	Scopes   []string `json:"-"`
+}
+
+func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserID: userID,
+		Expiry: time.Now().Add(ttl),
+		Scope:  scope,
+	}
+
+	randomBytes := make([]byte, 16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	token.Hash = hashToken(token.Plaintext)
+
+	return token, nil
+}
+
+func newTokenFamily() ([]byte, error) {
+	family := make([]byte, 16)
+	if _, err := rand.Read(family); err != nil {
+		return nil, err
+	}
+
+	return family, nil
+}
+
+func hashToken(plaintext string) []byte {
+	hash := sha256.Sum256([]byte(plaintext))
+	return hash[:]
+}
+
+// ValidateTokenPlaintext checks that a plaintext token has the length produced by generateToken.
+func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
+	v.Check(tokenPlaintext != "", "token", "must be provided")
+	v.Check(len(tokenPlaintext) == tokenPlaintextLength, "token", "must be 26 bytes long")
+}
+
+// TokenRepository provides access to the tokens table.
+type TokenRepository struct {
+	db *sql.DB
+}
+
+// NewTokenRepository returns a TokenRepository backed by the given database handle.
+func NewTokenRepository(db *sql.DB) *TokenRepository {
+	return &TokenRepository{db: db}
+}
+
+// New generates a token for the user with the given scope and lifetime and stores its hash.
+func (r *TokenRepository) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.Insert(ctx, token)
+	return token, err
+}
+
+// Insert stores the hash of a token.
+func (r *TokenRepository) Insert(ctx context.Context, token *Token) error {
+	query := `
+		INSERT INTO tokens (hash, user_id, expiry, scope, family, parent, ip, user_agent, client_id, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at`
+
+	args := []any{
+		token.Hash,
+		nullInt64(token.UserID),
+		token.Expiry,
+		token.Scope,
+		nullBytes(token.Family),
+		nullBytes(token.Parent),
+		nullString(token.IP),
+		nullString(token.UserAgent),
+		nullString(token.ClientID),
+		pq.Array(token.Scopes),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	return r.db.QueryRowContext(ctx, query, args...).Scan(&token.CreatedAt)
+}
+
+// DeleteAllForUser removes every token with the given scope belonging to the user.
+func (r *TokenRepository) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE scope = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, scope, userID)
+	return err
+}
+
+// DeleteAllScopesForUser removes every token belonging to the user regardless of scope.
+func (r *TokenRepository) DeleteAllScopesForUser(ctx context.Context, userID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Get returns the unexpired token with the given scope matching the plaintext, whether or not it has been used.
+func (r *TokenRepository) Get(ctx context.Context, scope, tokenPlaintext string) (*Token, error) {
+	query := `
+		SELECT hash, user_id, expiry, scope, family, parent, used_at IS NOT NULL
+		FROM tokens
+		WHERE hash = $1
+		AND scope = $2
+		AND expiry > $3`
+
+	args := []any{hashToken(tokenPlaintext), scope, time.Now()}
+
+	token := Token{Plaintext: tokenPlaintext}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&token.Hash,
+		&token.UserID,
+		&token.Expiry,
+		&token.Scope,
+		&token.Family,
+		&token.Parent,
+		&token.Used,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// GetForClient returns the unexpired token with the given scope matching the plaintext, provided it was issued to an
+// OAuth2 client.
+func (r *TokenRepository) GetForClient(ctx context.Context, scope, tokenPlaintext string) (*Token, error) {
+	query := `
+		SELECT hash, COALESCE(user_id, 0), expiry, scope, family, parent, used_at IS NOT NULL, created_at, client_id, scopes
+		FROM tokens
+		WHERE hash = $1
+		AND scope = $2
+		AND expiry > $3
+		AND client_id IS NOT NULL`
+
+	args := []any{hashToken(tokenPlaintext), scope, time.Now()}
+
+	token := Token{Plaintext: tokenPlaintext}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&token.Hash,
+		&token.UserID,
+		&token.Expiry,
+		&token.Scope,
+		&token.Family,
+		&token.Parent,
+		&token.Used,
+		&token.CreatedAt,
+		&token.ClientID,
+		pq.Array(&token.Scopes),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkUsed records that a token has been spent. It reports false if the token had already been marked, which lets
+// concurrent attempts to use the same token be told apart.
+func (r *TokenRepository) MarkUsed(ctx context.Context, hash []byte) (bool, error) {
+	query := `
+		UPDATE tokens
+		SET used_at = NOW()
+		WHERE hash = $1 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, hash)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows == 1, nil
+}
+
+// DeleteFamily removes every token issued from the same login as the given family.
+func (r *TokenRepository) DeleteFamily(ctx context.Context, family []byte) error {
+	query := `
+		DELETE FROM tokens
+		WHERE family = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, family)
+	return err
+}
+
+// GetSessionsForUser returns the user's active sessions, most recently used first. A session is a token family with
+// an unexpired access token or an unused, unexpired refresh token; it is described by when the family was created,
+// when any of its tokens was last used, and the address and user agent its newest token was issued to.
+func (r *TokenRepository) GetSessionsForUser(ctx context.Context, userID int64) ([]*Session, error) {
+	query := `
+		SELECT family, MIN(created_at), MAX(GREATEST(last_used_at, used_at)), MAX(expiry),
+			(ARRAY_AGG(COALESCE(ip, '') ORDER BY created_at DESC))[1],
+			(ARRAY_AGG(COALESCE(user_agent, '') ORDER BY created_at DESC))[1]
+		FROM tokens
+		WHERE user_id = $1
+		AND scope IN ($2, $3)
+		AND family IS NOT NULL
+		GROUP BY family
+		HAVING BOOL_OR(expiry > $4 AND (scope = $2 OR used_at IS NULL))
+		ORDER BY MAX(GREATEST(created_at, last_used_at, used_at)) DESC`
+
+	args := []any{userID, ScopeAuthentication, ScopeRefresh, time.Now()}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		var session Session
+
+		err := rows.Scan(
+			&session.family,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.IP,
+			&session.UserAgent,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Authenticate returns the caller presenting the unexpired token with the given scope and plaintext, recording the
+// time the token was last used. The caller carries the user's permissions, or, for a token issued to an OAuth2 client,
+// the client and the scopes it was granted in their place. ErrRecordNotFound is returned if there is no such token,
+// it was issued to a client on its own behalf, or its user has been deleted.
+func (r *TokenRepository) Authenticate(ctx context.Context, scope, tokenPlaintext string) (*middleware.User, error) {
+	query := `
+		UPDATE tokens
+		SET last_used_at = NOW()
+		FROM users
+		WHERE users.id = tokens.user_id
+		AND tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3
+		AND users.deleted_at IS NULL
+		RETURNING users.id, users.name, users.email, users.activated, COALESCE(tokens.client_id, ''), tokens.scopes,
+			ARRAY(
+				SELECT permissions.code
+				FROM permissions
+				INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+				WHERE users_permissions.user_id = users.id
+				AND tokens.client_id IS NULL
+			)`
+
+	args := []any{hashToken(tokenPlaintext), scope, time.Now()}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	var user middleware.User
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.Activated,
+		&user.ClientID,
+		pq.Array(&user.Scopes),
+		pq.Array(&user.Permissions),
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Delete removes the token with the given hash.
+func (r *TokenRepository) Delete(ctx context.Context, hash []byte) error {
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, query, hash)
+	return err
+}
+
+// nullBytes maps a nil slice to a SQL NULL rather than an empty bytea.
+func nullBytes(b []byte) any {
+	if b == nil {
+		return nil
+	}
+	return b
+}
+
+// nullInt64 maps a zero ID to a SQL NULL.
+func nullInt64(i int64) any {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+// nullString maps an empty string to a SQL NULL.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/badrchoubai/services/internal/middleware"
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const activationTokenTTL = 3 * 24 * time.Hour
+
+func (h *handler) registerUser(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	ValidateName(v, input.Name)
+	ValidateEmail(v, input.Email)
+	ValidatePasswordPlaintext(v, input.Password)
+
+	if err := h.passwords.Validate(v, "password", input.Password); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Only input that passed validation is hashed.
+	user := &User{
+		Name:      input.Name,
+		Email:     input.Email,
+		Activated: false,
+	}
+
+	if err := user.Password.Set(h.hasher, input.Password); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err := h.users.Insert(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrDuplicateEmail):
+			h.conflictResponse(w, r, map[string]string{"email": "a user with this email address already exists"})
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if defaults := h.config.DefaultPermissions(); len(defaults) > 0 {
+		if err := h.permissions.AddForUser(r.Context(), user.ID, defaults...); err != nil {
+			h.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	token, err := h.tokens.New(r.Context(), user.ID, activationTokenTTL, ScopeActivation)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.sendEmail(user.Email, "user_welcome.tmpl", map[string]any{
+		"Name":            user.Name,
+		"ActivationPath":  h.path + "/users/activated",
+		"ActivationToken": token.Plaintext,
+	})
+
+	h.encode(w, r, http.StatusCreated, envelope{"user": user})
+}
+
+func (h *handler) activateUser(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := h.users.GetForToken(r.Context(), ScopeActivation, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			h.failedValidationResponse(w, r, v.Errors)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user.Activated = true
+
+	err = h.users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEditConflict):
+			h.editConflictResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = h.tokens.DeleteAllForUser(r.Context(), ScopeActivation, user.ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.encode(w, r, http.StatusOK, envelope{"user": user})
+}
+
+func (h *handler) showCurrentUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.users.Get(r.Context(), middleware.ContextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			h.notFoundResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	h.encodeUser(w, r, http.StatusOK, user)
+}
+
+func (h *handler) updateUserPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	if err := h.encoderDecoder.DecodeRequest(r, &input); err != nil {
+		h.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	ValidateTokenPlaintext(v, input.TokenPlaintext)
+	ValidatePasswordPlaintext(v, input.Password)
+
+	if err := h.passwords.Validate(v, "password", input.Password); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		h.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := h.users.GetForToken(r.Context(), ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			h.failedValidationResponse(w, r, v.Errors)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if err := user.Password.Set(h.hasher, input.Password); err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = h.users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEditConflict):
+			h.editConflictResponse(w, r)
+		default:
+			h.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// A password reset invalidates every outstanding credential, including sessions an attacker may hold.
+	err = h.tokens.DeleteAllScopesForUser(r.Context(), user.ID)
+	if err != nil {
+		h.serverErrorResponse(w, r, err)
+		return
+	}
+
+	h.audit(r, &AuditEvent{
+		Action:   AuditActionPasswordReset,
+		ActorID:  &user.ID,
+		TargetID: &user.ID,
+		Outcome:  AuditOutcomeSuccess,
+	})
+
+	h.encode(w, r, http.StatusOK, envelope{"message": "your password was successfully reset"})
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPasswordResetRevokesTokens(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	ts.createActivatedUser(t, "Alice", testEmail, testPassword)
+
+	status, old := ts.login(t, testEmail, testPassword)
+	if status != http.StatusCreated {
+		t.Fatalf("logging in: got status %d", status)
+	}
+
+	if status := ts.do(t, http.MethodGet, "/users/me", old.AuthenticationToken.Token, nil, nil); status != http.StatusOK {
+		t.Fatalf("using the token before the reset: got status %d", status)
+	}
+
+	input := map[string]string{"email": testEmail}
+	if status := ts.do(t, http.MethodPost, "/tokens/password-reset", "", input, nil); status != http.StatusAccepted {
+		t.Fatalf("requesting a reset: got status %d", status)
+	}
+
+	// The welcome email came first.
+	resetToken := emailToken(t, ts.waitForEmail(t, testEmail, 2))
+
+	const newPassword = "tremendous-purple-octopus-ladder"
+
+	input = map[string]string{"password": newPassword, "token": resetToken}
+	if status := ts.do(t, http.MethodPut, "/users/password", "", input, nil); status != http.StatusOK {
+		t.Fatalf("resetting the password: got status %d", status)
+	}
+
+	status = ts.do(t, http.MethodGet, "/users/me", old.AuthenticationToken.Token, nil, nil)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("using the old access token: got status %d", status)
+	}
+
+	input = map[string]string{"refreshToken": old.RefreshToken.Token}
+	if status := ts.do(t, http.MethodPost, "/tokens/refresh", "", input, nil); status != http.StatusUnauthorized {
+		t.Fatalf("using the old refresh token: got status %d", status)
+	}
+
+	// The reset token was revoked along with everything else.
+	input = map[string]string{"password": "another-entirely-new-password", "token": resetToken}
+	if status := ts.do(t, http.MethodPut, "/users/password", "", input, nil); status != http.StatusUnprocessableEntity {
+		t.Fatalf("reusing the reset token: got status %d", status)
+	}
+
+	if status, _ := ts.login(t, testEmail, testPassword); status != http.StatusUnauthorized {
+		t.Fatalf("logging in with the old password: got status %d", status)
+	}
+
+	status, current := ts.login(t, testEmail, newPassword)
+	if status != http.StatusCreated {
+		t.Fatalf("logging in with the new password: got status %d", status)
+	}
+
+	status = ts.do(t, http.MethodGet, "/users/me", current.AuthenticationToken.Token, nil, nil)
+	if status != http.StatusOK {
+		t.Fatalf("using the new access token: got status %d", status)
+	}
+}
@@ -0,0 +1,447 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+
+	"github.com/badrchoubai/services/internal/passwords"
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+const (
+	// queryTimeout bounds how long a single repository query may run.
+	queryTimeout = 3 * time.Second
+
+	// uniqueViolation is the Postgres error code raised when a UNIQUE constraint is violated.
+	uniqueViolation = "23505"
+)
+
+var (
+	// ErrEditConflict is returned when an update matches no row because the user's version has changed since it
+	// was read.
+	ErrEditConflict = errors.New("edit conflict")
+
+	// ErrDuplicateEmail is returned when inserting or updating a user would violate the unique email constraint.
+	ErrDuplicateEmail = errors.New("duplicate email")
+
+	// ErrRecordNotFound is returned when a query matches no rows.
+	ErrRecordNotFound = errors.New("record not found")
+)
+
+// User represents a single account stored in the users table.
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Password  password  `json:"-"`
+	Activated bool      `json:"activated"`
+	Version   int       `json:"-"`
+
+	// PendingEmail is the address the user has asked to change to, until they confirm they own it.
+	PendingEmail *string `json:"pendingEmail,omitempty"`
+
+	// DeletedAt is when the user deleted their account. The account is kept, unable to log in, until the deletion
+	// grace period has passed.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+type password struct {
+	plaintext *string
+	hash      string
+}
+
+// Set hashes a plaintext password with the hasher's preferred algorithm and stores both values on the password. The
+// plaintext must already have passed ValidatePasswordPlaintext, since bcrypt fails on passwords longer than it can hash
+// rather than reporting them as invalid.
+func (p *password) Set(hasher *passwords.Hasher, plaintext string) error {
+	hash, err := hasher.Hash(plaintext)
+	if err != nil {
+		return err
+	}
+
+	p.plaintext = &plaintext
+	p.hash = hash
+
+	return nil
+}
+
+// Matches checks whether the plaintext password matches the stored hash. On a match, rehash reports whether the hash
+// was made with an outdated algorithm or parameters and should be replaced by calling Set with the same plaintext.
+func (p *password) Matches(hasher *passwords.Hasher, plaintext string) (match, rehash bool, err error) {
+	return hasher.Verify(p.hash, plaintext)
+}
+
+// ValidateEmail checks that an email address is present and well-formed.
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "must be provided")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
+}
+
+// ValidatePasswordPlaintext checks that a plaintext password is present and within bcrypt's length limit. New passwords
+// must also satisfy the configured passwords.Policy, which is not applied here so that a stricter policy does not lock
+// out users whose existing passwords predate it.
+func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+}
+
+// ValidateName checks that a user's name is present and not overly long.
+func ValidateName(v *validator.Validator, name string) {
+	v.Check(name != "", "name", "must be provided")
+	v.Check(len(name) <= 500, "name", "must not be more than 500 bytes long")
+}
+
+// ValidateUser checks the fields of a User before it is written to the database.
+func ValidateUser(v *validator.Validator, user *User) {
+	ValidateName(v, user.Name)
+	ValidateEmail(v, user.Email)
+
+	if user.Password.plaintext != nil {
+		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+	}
+
+	// Every account is created with a password, so a missing hash means the stored row is damaged. Reporting it as a
+	// validation error refuses the write without taking down the request.
+	v.Check(user.Password.hash != "", "password", "is missing for this account")
+}
+
+// UserRepository provides access to the users table.
+type UserRepository struct {
+	db *sql.DB
+}
+
+// NewUserRepository returns a UserRepository backed by the given database handle.
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// Insert adds a new user, populating the ID, CreatedAt and Version fields from the inserted row.
+func (r *UserRepository) Insert(ctx context.Context, user *User) error {
+	query := `
+		INSERT INTO users (name, email, password_hash, activated)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, version`
+
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		if isUniqueViolation(err, "users_email_key") {
+			return ErrDuplicateEmail
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Get returns the user with the given ID, or ErrRecordNotFound.
+func (r *UserRepository) Get(ctx context.Context, id int64) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, version, pending_email, deleted_at
+		FROM users
+		WHERE id = $1`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.PendingEmail,
+		&user.DeletedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetByEmail returns the user with the given email address, or ErrRecordNotFound. Deleted users are not returned.
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, version, pending_email, deleted_at
+		FROM users
+		WHERE email = $1 AND deleted_at IS NULL`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.PendingEmail,
+		&user.DeletedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetForToken returns the user owning an unexpired token with the given scope, or ErrRecordNotFound. Deleted users
+// are not returned.
+func (r *UserRepository) GetForToken(ctx context.Context, scope, tokenPlaintext string) (*User, error) {
+	query := `
+		SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated,
+			users.version, users.pending_email, users.deleted_at
+		FROM users
+		INNER JOIN tokens
+		ON users.id = tokens.user_id
+		WHERE tokens.hash = $1
+		AND tokens.scope = $2
+		AND tokens.expiry > $3
+		AND users.deleted_at IS NULL`
+
+	args := []any{hashToken(tokenPlaintext), scope, time.Now()}
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.PendingEmail,
+		&user.DeletedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// UserFilter narrows a listing of users. Name and Email match anywhere in the field, ignoring case; empty strings and
+// nil booleans match every user.
+type UserFilter struct {
+	Name      string
+	Email     string
+	Activated *bool
+	Deleted   *bool
+}
+
+// GetAll returns the page of users matching the filter, ordered as the filters ask, along with pagination metadata.
+func (r *UserRepository) GetAll(ctx context.Context, filter UserFilter, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, name, email, password_hash, activated, version, pending_email,
+			deleted_at
+		FROM users
+		WHERE ($1 = '' OR name ILIKE $2)
+		AND ($3 = '' OR email ILIKE $4)
+		AND ($5::bool IS NULL OR activated = $5)
+		AND ($6::bool IS NULL OR (deleted_at IS NOT NULL) = $6)
+		ORDER BY %s %s, id ASC
+		LIMIT $7 OFFSET $8`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{
+		filter.Name,
+		likePattern(filter.Name),
+		filter.Email,
+		likePattern(filter.Email),
+		filter.Activated,
+		filter.Deleted,
+		filters.limit(),
+		filters.offset(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Version,
+			&user.PendingEmail,
+			&user.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return users, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Update writes the user's mutable fields and increments its version. The update only applies if the stored version
+// still matches user.Version; otherwise ErrEditConflict is returned.
+func (r *UserRepository) Update(ctx context.Context, user *User) error {
+	query := `
+		UPDATE users
+		SET name = $1, email = $2, password_hash = $3, activated = $4, pending_email = $5, deleted_at = $6,
+			version = version + 1
+		WHERE id = $7 AND version = $8
+		RETURNING version`
+
+	args := []any{
+		user.Name,
+		user.Email,
+		user.Password.hash,
+		user.Activated,
+		user.PendingEmail,
+		user.DeletedAt,
+		user.ID,
+		user.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	err := r.db.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "users_email_key"):
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdatePasswordHash replaces the user's password hash with a rehash of the same password. It leaves the version
+// alone, since nothing a client can see has changed, and returns ErrEditConflict if the stored hash is no longer
+// previous because the password was changed in the meantime.
+func (r *UserRepository) UpdatePasswordHash(ctx context.Context, user *User, previous string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1
+		WHERE id = $2 AND password_hash = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, user.Password.hash, user.ID, previous)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Delete removes the user with the given ID along with everything that references them, returning ErrRecordNotFound
+// if there is no such user.
+func (r *UserRepository) Delete(ctx context.Context, id int64) error {
+	query := `
+		DELETE FROM users
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeDeleted permanently removes every user who deleted their account before the given time, returning how many
+// were removed.
+func (r *UserRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+		DELETE FROM users
+		WHERE deleted_at < $1`
+
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	result, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == uniqueViolation && pqErr.Constraint == constraint
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/badrchoubai/services/internal/validator"
+)
+
+func TestValidateUser(t *testing.T) {
+	long := strings.Repeat("x", 73)
+
+	tests := []struct {
+		name  string
+		user  *User
+		field string
+	}{
+		{
+			name: "valid",
+			user: &User{Name: "Alice", Email: testEmail, Password: password{hash: "$argon2id$..."}},
+		},
+		{
+			name:  "missing hash",
+			user:  &User{Name: "Alice", Email: testEmail},
+			field: "password",
+		},
+		{
+			name:  "password too long",
+			user:  &User{Name: "Alice", Email: testEmail, Password: password{plaintext: &long, hash: "$argon2id$..."}},
+			field: "password",
+		},
+		{
+			name:  "invalid email",
+			user:  &User{Name: "Alice", Email: "alice", Password: password{hash: "$argon2id$..."}},
+			field: "email",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateUser(v, tt.user)
+
+			if tt.field == "" {
+				if !v.Valid() {
+					t.Fatalf("got %v, want no errors", v.Errors)
+				}
+				return
+			}
+
+			if _, ok := v.Errors[tt.field]; !ok || len(v.Errors) != 1 {
+				t.Fatalf("got %v, want a single error for %s", v.Errors, tt.field)
+			}
+		})
+	}
+}
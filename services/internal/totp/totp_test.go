@@ -0,0 +1,72 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 secret of the RFC 6238 test vectors.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode(t *testing.T) {
+	// The RFC 6238 appendix B vectors are eight digits long; six digit codes are their last six digits.
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := Code(rfcSecret, Step(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("T=%d: got %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		want   bool
+	}{
+		{name: "two steps behind", offset: -2, want: false},
+		{name: "one step behind", offset: -1, want: true},
+		{name: "current step", offset: 0, want: true},
+		{name: "one step ahead", offset: 1, want: true},
+		{name: "two steps ahead", offset: 2, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, Code(rfcSecret, current+tt.offset), now)
+			if ok != tt.want {
+				t.Fatalf("got %t, want %t", ok, tt.want)
+			}
+
+			if ok && step != current+tt.offset {
+				t.Errorf("got step %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+
+	if _, ok := Validate(rfcSecret, "000000", now); ok {
+		t.Error("accepted a wrong code")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	got := ProvisioningURI("Auth Service", "alice@example.com", rfcSecret)
+	want := "otpauth://totp/Auth%20Service:alice@example.com" +
+		"?algorithm=SHA1&digits=6&issuer=Auth+Service&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
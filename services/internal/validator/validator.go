@@ -0,0 +1,53 @@
+// Package validator provides a small helper for collecting field-level validation errors while checking user input.
+// Handlers create a Validator, run their checks against it, and return the accumulated errors to the caller when the
+// input is not valid.
+package validator
+
+import (
+	"regexp"
+	"slices"
+)
+
+// EmailRX is a regular expression used to sanity check the format of email addresses.
+var EmailRX = regexp.MustCompile(
+	"^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$",
+)
+
+// Validator holds a map of validation errors keyed by the name of the offending field.
+type Validator struct {
+	Errors map[string]string
+}
+
+// New returns a Validator with an empty errors map.
+func New() *Validator {
+	return &Validator{Errors: make(map[string]string)}
+}
+
+// Valid returns true if no errors have been recorded.
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// AddError records an error message for the given key, keeping the first message if one is already present.
+func (v *Validator) AddError(key, message string) {
+	if _, exists := v.Errors[key]; !exists {
+		v.Errors[key] = message
+	}
+}
+
+// Check adds an error message for the given key only if the validation check is not ok.
+func (v *Validator) Check(ok bool, key, message string) {
+	if !ok {
+		v.AddError(key, message)
+	}
+}
+
+// PermittedValue returns true if value is in the list of permitted values.
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	return slices.Contains(permittedValues, value)
+}
+
+// Matches returns true if value matches the regular expression rx.
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
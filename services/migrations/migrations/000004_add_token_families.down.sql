@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS tokens_family_idx;
+
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS used_at,
+    DROP COLUMN IF EXISTS parent,
+    DROP COLUMN IF EXISTS family;
\ No newline at end of file
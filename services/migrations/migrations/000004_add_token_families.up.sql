@@ -0,0 +1,6 @@
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS family  bytea,
+    ADD COLUMN IF NOT EXISTS parent  bytea,
+    ADD COLUMN IF NOT EXISTS used_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS tokens_family_idx ON tokens (family);
\ No newline at end of file
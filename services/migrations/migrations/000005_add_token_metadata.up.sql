@@ -0,0 +1,5 @@
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS created_at   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS last_used_at timestamp(0) with time zone,
+    ADD COLUMN IF NOT EXISTS ip           text,
+    ADD COLUMN IF NOT EXISTS user_agent   text;
\ No newline at end of file
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS users_totp
+(
+    user_id        bigint PRIMARY KEY REFERENCES users ON DELETE CASCADE,
+    secret         bytea                       NOT NULL,
+    created_at     timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    confirmed_at   timestamp(0) with time zone,
+    last_used_step bigint                      NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes
+(
+    hash    bytea PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    used_at timestamp(0) with time zone
+);
\ No newline at end of file
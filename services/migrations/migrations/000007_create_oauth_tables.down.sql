@@ -0,0 +1,13 @@
+DELETE FROM permissions
+WHERE code = 'clients:write';
+
+DELETE FROM tokens
+WHERE user_id IS NULL;
+
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS scopes,
+    DROP COLUMN IF EXISTS client_id,
+    ALTER COLUMN user_id SET NOT NULL;
+
+DROP TABLE IF EXISTS authorization_codes;
+DROP TABLE IF EXISTS clients;
\ No newline at end of file
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS clients
+(
+    id            text PRIMARY KEY,
+    secret_hash   bytea,
+    name          text                        NOT NULL,
+    redirect_uris text[]                      NOT NULL DEFAULT '{}',
+    grant_types   text[]                      NOT NULL DEFAULT '{}',
+    scopes        text[]                      NOT NULL DEFAULT '{}',
+    created_at    timestamp(0) with time zone NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS authorization_codes
+(
+    hash           bytea PRIMARY KEY,
+    client_id      text                        NOT NULL REFERENCES clients ON DELETE CASCADE,
+    user_id        bigint                      NOT NULL REFERENCES users ON DELETE CASCADE,
+    redirect_uri   text                        NOT NULL,
+    scopes         text[]                      NOT NULL DEFAULT '{}',
+    code_challenge text                        NOT NULL,
+    expiry         timestamp(0) with time zone NOT NULL
+);
+
+ALTER TABLE tokens
+    ALTER COLUMN user_id DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS client_id text REFERENCES clients ON DELETE CASCADE,
+    ADD COLUMN IF NOT EXISTS scopes    text[];
+
+INSERT INTO permissions (code)
+VALUES ('clients:write');
\ No newline at end of file
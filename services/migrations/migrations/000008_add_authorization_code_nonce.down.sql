@@ -0,0 +1,2 @@
+ALTER TABLE authorization_codes
+    DROP COLUMN IF EXISTS nonce;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    key             text PRIMARY KEY,
+    failures        integer                     NOT NULL DEFAULT 0,
+    last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    locked_until    timestamp(0) with time zone
+);
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ALTER COLUMN password_hash TYPE bytea USING convert_to(password_hash, 'UTF8');
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ALTER COLUMN password_hash TYPE text USING convert_from(password_hash, 'UTF8');
\ No newline at end of file
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS audit_events
+(
+    id         bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL,
+    actor_id   bigint,
+    action     text                        NOT NULL,
+    target_id  bigint,
+    target     text                        NOT NULL DEFAULT '',
+    outcome    text                        NOT NULL,
+    ip         text                        NOT NULL DEFAULT '',
+    user_agent text                        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_target_id_idx ON audit_events (target_id, id);
+CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action, id);
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
+
+INSERT INTO permissions (code)
+VALUES ('audit:read');
\ No newline at end of file